@@ -0,0 +1,306 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vieira/tidyphotos/internal/db"
+)
+
+// albumResponse is the JSON shape of an album
+type albumResponse struct {
+	ID           int64           `json:"id"`
+	Name         string          `json:"name"`
+	Description  string          `json:"description,omitempty"`
+	PhotoCount   int             `json:"photo_count"`
+	CoverPhotoID *int64          `json:"cover_photo_id,omitempty"` // Chosen cover or first photo
+	Cover        string          `json:"cover,omitempty"`          // Its thumbnail
+	CreatedAt    int64           `json:"created_at"`
+	UpdatedAt    int64           `json:"updated_at"`
+	Photos       []PhotoResponse `json:"photos,omitempty"` // In album order, for a single album
+}
+
+func newAlbumResponse(album db.Album) albumResponse {
+	resp := albumResponse{
+		ID:          album.ID,
+		Name:        album.Name,
+		Description: album.Description.String,
+		PhotoCount:  album.PhotoCount,
+		CreatedAt:   album.CreatedAt,
+		UpdatedAt:   album.UpdatedAt,
+	}
+	if album.CoverID.Valid {
+		resp.CoverPhotoID = &album.CoverID.Int64
+		resp.Cover = thumbnailURL(album.CoverID.Int64, album.CoverHash)
+	}
+	return resp
+}
+
+// handleAlbums handles GET (list) and POST (create) for albums. A new
+// album can be given its photos, in order, with photo_ids.
+func handleAlbums(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			albums, err := database.GetAlbums()
+			if err != nil {
+				http.Error(w, "Failed to get albums", http.StatusInternalServerError)
+				log.Printf("Error getting albums: %v", err)
+				return
+			}
+
+			response := make([]albumResponse, len(albums))
+			for i, album := range albums {
+				response[i] = newAlbumResponse(album)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
+
+		case "POST":
+			var req struct {
+				Name        string  `json:"name"`
+				Description string  `json:"description"`
+				PhotoIDs    []int64 `json:"photo_ids"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request", http.StatusBadRequest)
+				return
+			}
+
+			req.Name = strings.TrimSpace(req.Name)
+			if req.Name == "" {
+				http.Error(w, "Name is required", http.StatusBadRequest)
+				return
+			}
+
+			id, err := database.InsertAlbum(req.Name, nullString(req.Description), req.PhotoIDs)
+			if err != nil {
+				writeAlbumError(w, "Failed to create album", err)
+				return
+			}
+
+			writeAlbum(w, database, id, http.StatusCreated)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// handleAlbumActions routes /api/albums/{id} and /api/albums/{id}/photos
+func handleAlbumActions(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/albums/"), "/")
+		albumID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid album ID", http.StatusBadRequest)
+			return
+		}
+
+		switch action {
+		case "":
+			handleAlbum(database, albumID, w, r)
+		case "photos":
+			handleAlbumPhotos(database, albumID, w, r)
+		default:
+			http.Error(w, "Unknown album action", http.StatusNotFound)
+		}
+	}
+}
+
+// handleAlbum handles GET (with photos), PUT (update) and DELETE for an
+// album. PUT changes the fields present: name, description, and
+// cover_photo_id, which null resets to the first photo.
+func handleAlbum(database *db.DB, albumID int64, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		writeAlbum(w, database, albumID, http.StatusOK)
+
+	case "PUT":
+		var req struct {
+			Name         *string         `json:"name"`
+			Description  *string         `json:"description"`
+			CoverPhotoID json.RawMessage `json:"cover_photo_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		var update db.AlbumUpdate
+		if req.Name != nil {
+			name := strings.TrimSpace(*req.Name)
+			if name == "" {
+				http.Error(w, "Name is required", http.StatusBadRequest)
+				return
+			}
+			update.Name = &name
+		}
+		if req.Description != nil {
+			description := nullString(*req.Description)
+			update.Description = &description
+		}
+		if req.CoverPhotoID != nil {
+			var cover *int64
+			if err := json.Unmarshal(req.CoverPhotoID, &cover); err != nil {
+				http.Error(w, "cover_photo_id must be a photo ID or null", http.StatusBadRequest)
+				return
+			}
+			var coverID sql.NullInt64
+			if cover != nil {
+				coverID = sql.NullInt64{Int64: *cover, Valid: true}
+			}
+			update.CoverPhotoID = &coverID
+		}
+
+		// Applied together, so a bad cover leaves the name untouched
+		if err := database.UpdateAlbum(albumID, update); err != nil {
+			writeAlbumError(w, "Failed to update album", err)
+			return
+		}
+
+		writeAlbum(w, database, albumID, http.StatusOK)
+
+	case "DELETE":
+		if err := database.DeleteAlbum(albumID); err != nil {
+			writeAlbumError(w, "Failed to delete album", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAlbumPhotos handles the membership of an album: GET lists its
+// photos in order, POST adds photo_ids (before position, or at the end),
+// DELETE removes photo_ids and PUT moves photo_ids, in order, to the start
+func handleAlbumPhotos(database *db.DB, albumID int64, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		if _, err := database.GetAlbum(albumID); err != nil {
+			writeAlbumError(w, "Failed to get album", err)
+			return
+		}
+		photos, err := database.GetAlbumPhotos(albumID)
+		if err != nil {
+			writeAlbumError(w, "Failed to get album photos", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newPhotoResponses(photos))
+		return
+	case "POST", "DELETE", "PUT":
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		PhotoIDs []int64 `json:"photo_ids"`
+		Position *int    `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if len(req.PhotoIDs) == 0 {
+		http.Error(w, "photo_ids is required", http.StatusBadRequest)
+		return
+	}
+
+	result := map[string]interface{}{}
+	switch r.Method {
+	case "POST":
+		position := -1
+		if req.Position != nil {
+			if *req.Position < 0 {
+				http.Error(w, "position must not be negative", http.StatusBadRequest)
+				return
+			}
+			position = *req.Position
+		}
+		added, err := database.AddAlbumPhotos(albumID, req.PhotoIDs, position)
+		if err != nil {
+			writeAlbumError(w, "Failed to add photos to album", err)
+			return
+		}
+		result["added"] = added
+
+	case "DELETE":
+		removed, err := database.RemoveAlbumPhotos(albumID, req.PhotoIDs)
+		if err != nil {
+			writeAlbumError(w, "Failed to remove photos from album", err)
+			return
+		}
+		result["removed"] = removed
+
+	case "PUT":
+		if err := database.ReorderAlbumPhotos(albumID, req.PhotoIDs); err != nil {
+			writeAlbumError(w, "Failed to reorder album", err)
+			return
+		}
+	}
+
+	album, err := database.GetAlbum(albumID)
+	if err != nil {
+		writeAlbumError(w, "Failed to get album", err)
+		return
+	}
+	result["photo_count"] = album.PhotoCount
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// writeAlbum responds with an album and its photos
+func writeAlbum(w http.ResponseWriter, database *db.DB, albumID int64, status int) {
+	album, err := database.GetAlbum(albumID)
+	if err != nil {
+		writeAlbumError(w, "Failed to get album", err)
+		return
+	}
+	photos, err := database.GetAlbumPhotos(albumID)
+	if err != nil {
+		writeAlbumError(w, "Failed to get album photos", err)
+		return
+	}
+
+	resp := newAlbumResponse(*album)
+	resp.Photos = newPhotoResponses(photos)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeAlbumError maps album errors to responses, logging unexpected ones
+// under message
+func writeAlbumError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Album not found", http.StatusNotFound)
+	case errors.Is(err, db.ErrAlbumNameTaken):
+		http.Error(w, "An album with this name already exists", http.StatusConflict)
+	case errors.Is(err, db.ErrNotInAlbum), errors.Is(err, db.ErrUnknownPhoto):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+		log.Printf("%s: %v", message, err)
+	}
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	s = strings.TrimSpace(s)
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/vieira/tidyphotos/internal/db"
+)
+
+// handleDuplicates lists groups of photos with identical file content
+func handleDuplicates(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		groups, err := database.GetDuplicateGroups()
+		if err != nil {
+			http.Error(w, "Failed to get duplicates", http.StatusInternalServerError)
+			log.Printf("Error getting duplicates: %v", err)
+			return
+		}
+
+		type DuplicatePhoto struct {
+			PhotoResponse
+			Path string `json:"path"`
+		}
+
+		type DuplicateGroupResponse struct {
+			Hash        string           `json:"hash"`
+			Size        int64            `json:"size"`
+			WastedBytes int64            `json:"wasted_bytes"`
+			Photos      []DuplicatePhoto `json:"photos"`
+		}
+
+		var wasted int64
+		response := make([]DuplicateGroupResponse, len(groups))
+		for i, group := range groups {
+			photos := make([]DuplicatePhoto, len(group.Photos))
+			for j, photo := range group.Photos {
+				photos[j] = DuplicatePhoto{
+					PhotoResponse: newPhotoResponse(photo),
+					Path:          photo.Path,
+				}
+			}
+
+			// Every copy beyond the first is reclaimable
+			groupWasted := group.FileSize * int64(len(group.Photos)-1)
+			wasted += groupWasted
+
+			response[i] = DuplicateGroupResponse{
+				Hash:        group.ContentHash,
+				Size:        group.FileSize,
+				WastedBytes: groupWasted,
+				Photos:      photos,
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"groups":       response,
+			"wasted_bytes": wasted,
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/vieira/tidyphotos/internal/importer"
+)
+
+// eventHub fans library changes out to connected /api/events clients
+type eventHub struct {
+	mu      sync.Mutex
+	clients map[chan importer.Change]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{clients: make(map[chan importer.Change]struct{})}
+}
+
+// publish sends a change to every client. Clients too slow to keep up miss
+// the change rather than blocking the watcher.
+func (h *eventHub) publish(c importer.Change) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.clients {
+		select {
+		case ch <- c:
+		default:
+		}
+	}
+}
+
+func (h *eventHub) subscribe() chan importer.Change {
+	ch := make(chan importer.Change, 64)
+	h.mu.Lock()
+	h.clients[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan importer.Change) {
+	h.mu.Lock()
+	delete(h.clients, ch)
+	h.mu.Unlock()
+}
+
+// handleEvents streams library changes as Server-Sent Events. Each event is
+// named after its change type ("added", "updated", "moved", "missing") and
+// carries {"type", "id", "path"} as data.
+func handleEvents(hub *eventHub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		ch := hub.subscribe()
+		defer hub.unsubscribe(ch)
+
+		// Comments keep idle connections from being closed by proxies
+		keepAlive := time.NewTicker(30 * time.Second)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+
+			case c := <-ch:
+				data, err := json.Marshal(c)
+				if err != nil {
+					log.Printf("Error encoding event: %v", err)
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", c.Type, data)
+				flusher.Flush()
+
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				flusher.Flush()
+			}
+		}
+	}
+}
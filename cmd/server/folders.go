@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/vieira/tidyphotos/internal/db"
+)
+
+// folderResponse is the JSON shape of a folder of the photos directory.
+// Paths are relative to it, with forward slashes; the root is "".
+type folderResponse struct {
+	Path       string           `json:"path"`
+	Name       string           `json:"name"`
+	Parent     *string          `json:"parent,omitempty"`
+	PhotoCount int              `json:"photo_count"` // Including subfolders
+	Cover      string           `json:"cover,omitempty"`
+	Folders    []folderResponse `json:"folders,omitempty"`
+	Photos     []PhotoResponse  `json:"photos,omitempty"`
+}
+
+func newFolderResponse(folder db.Folder, photosDir string) folderResponse {
+	resp := folderResponse{
+		Path:       relativeFolderPath(folder.Path, photosDir),
+		Name:       folder.Name,
+		PhotoCount: folder.PhotoCount,
+	}
+	if folder.CoverID.Valid {
+		resp.Cover = thumbnailURL(folder.CoverID.Int64, folder.CoverHash)
+	}
+	return resp
+}
+
+// handleFolders returns a folder of the photos directory, /api/folders/{path}
+// or /api/folders for the root, with its subfolders and the photos directly
+// in it, newest first. Subfolders whose photos are all missing are left out.
+func handleFolders(database *db.DB, photosDir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		rel := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/folders"), "/")
+		folder, err := database.GetFolder(filepath.Join(filepath.Clean(photosDir), filepath.FromSlash(rel)))
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Folder not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to get folder", http.StatusInternalServerError)
+			log.Printf("Error getting folder %q: %v", rel, err)
+			return
+		}
+
+		subfolders, err := database.GetSubfolders(folder.ID)
+		if err != nil {
+			http.Error(w, "Failed to get folder", http.StatusInternalServerError)
+			log.Printf("Error getting subfolders of %q: %v", rel, err)
+			return
+		}
+
+		page, err := database.ListPhotos(db.PhotoFilter{FolderID: folder.ID}, nil, 0)
+		if err != nil {
+			http.Error(w, "Failed to get photos", http.StatusInternalServerError)
+			log.Printf("Error getting photos of folder %q: %v", rel, err)
+			return
+		}
+
+		resp := newFolderResponse(*folder, photosDir)
+		if folder.ParentID.Valid {
+			parent := relativeFolderPath(filepath.Dir(folder.Path), photosDir)
+			resp.Parent = &parent
+		}
+		for _, sub := range subfolders {
+			if sub.PhotoCount > 0 {
+				resp.Folders = append(resp.Folders, newFolderResponse(sub, photosDir))
+			}
+		}
+		resp.Photos = newPhotoResponses(page.Photos)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// relativeFolderPath returns the API path of a folder below photosDir
+func relativeFolderPath(path, photosDir string) string {
+	rel, err := filepath.Rel(filepath.Clean(photosDir), path)
+	if err != nil || rel == "." {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
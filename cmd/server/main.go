@@ -1,15 +1,26 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/vieira/tidyphotos/internal/db"
+	"github.com/vieira/tidyphotos/internal/geocode"
 	"github.com/vieira/tidyphotos/internal/importer"
 )
 
@@ -38,13 +49,70 @@ func main() {
 	defer database.Close()
 	log.Printf("   Database: %s", dbPath)
 
-	// Run photo import on startup
-	log.Printf("\n⚡ Scanning photo library...")
 	imp := importer.New(database, photosDir, thumbDir)
-	if err := imp.ScanAndImport(); err != nil {
-		log.Printf("⚠️  Import warning: %v", err)
+	defer imp.Close()
+	if v := getEnv("IMPORT_WORKERS", ""); v != "" {
+		workers, err := strconv.Atoi(v)
+		if err != nil || workers < 1 {
+			log.Fatalf("Invalid IMPORT_WORKERS: %q", v)
+		}
+		imp.SetWorkers(workers)
+	}
+	if v := getEnv("TRANSCODE_CACHE_MB", ""); v != "" {
+		mb, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || mb < 0 {
+			log.Fatalf("Invalid TRANSCODE_CACHE_MB: %q", v)
+		}
+		imp.SetTranscodeCacheSize(mb << 20)
+	}
+	thumbnailer, err := importer.ThumbnailGeneratorByName(getEnv("THUMBNAILER", "auto"))
+	if err != nil {
+		log.Fatalf("Invalid THUMBNAILER: %v", err)
+	}
+	imp.SetThumbnailGenerator(thumbnailer)
+	if dir := getEnv("GEONAMES_DIR", ""); dir != "" {
+		geocoder, err := geocode.Load(os.DirFS(dir))
+		if err != nil {
+			log.Fatalf("Invalid GEONAMES_DIR: %v", err)
+		}
+		imp.SetGeocoder(geocoder)
+		log.Printf("   Gazetteer: %s", dir)
+	}
+
+	watch := getEnv("WATCH", "true") != "false"
+	debounce, err := time.ParseDuration(getEnv("WATCH_DEBOUNCE", "2s"))
+	if err != nil || debounce < importer.MinDebounce {
+		log.Fatalf("Invalid WATCH_DEBOUNCE: %q (must be a duration of at least %v)", getEnv("WATCH_DEBOUNCE", "2s"), importer.MinDebounce)
 	}
 
+	// Stop serving on SIGINT or SIGTERM; requests, including event streams,
+	// see their context cancelled
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Run photo import in the background so the UI can follow its progress,
+	// then keep the library in sync with the photos directory while running.
+	// The watcher is handed over to be closed on shutdown.
+	events := newEventHub()
+	watchers := make(chan *importer.Watcher, 1)
+	go func() {
+		defer close(watchers)
+
+		log.Printf("\n⚡ Scanning photo library...")
+		if err := imp.ScanAndImport(); err != nil {
+			log.Printf("⚠️  Import warning: %v", err)
+		}
+
+		if watch && ctx.Err() == nil {
+			watcher, err := imp.Watch(debounce, events.publish)
+			if err != nil {
+				log.Printf("⚠️  Failed to watch photos directory: %v", err)
+				return
+			}
+			watchers <- watcher
+		}
+	}()
+
 	// Setup routes
 	mux := http.NewServeMux()
 
@@ -59,12 +127,26 @@ func main() {
 	mux.HandleFunc("/api/people/", handlePersonActions(database))
 	mux.HandleFunc("/api/face-tags", handleFaceTags(database))
 	mux.HandleFunc("/api/face-tags/", handleFaceTagActions(database))
+	mux.HandleFunc("/api/favorites", handleBulkFavorites(database))
+	mux.HandleFunc("/api/duplicates", handleDuplicates(database))
+	mux.HandleFunc("/api/similar", handleSimilarClusters(database))
+	mux.HandleFunc("/api/similar/", handleSimilarPhotos(database))
+	mux.HandleFunc("/api/places", handlePlaces(database))
+	mux.HandleFunc("/api/places/tree", handlePlaceTree(database))
+	mux.HandleFunc("/api/albums", handleAlbums(database))
+	mux.HandleFunc("/api/albums/", handleAlbumActions(database))
+	mux.HandleFunc("/api/smart-albums", handleSmartAlbums(database))
+	mux.HandleFunc("/api/smart-albums/", handleSmartAlbumActions(database))
+	mux.HandleFunc("/api/folders", handleFolders(database, photosDir))
+	mux.HandleFunc("/api/folders/", handleFolders(database, photosDir))
+	mux.HandleFunc("/api/events", handleEvents(events))
+	mux.HandleFunc("/api/import/progress", handleImportProgress(imp))
 
 	// Thumbnail serving (instant, filesystem-based)
 	mux.HandleFunc("/api/thumbnails/", serveThumbnail(thumbDir))
 
-	// Photo serving (instant, filesystem-based)
-	mux.HandleFunc("/api/photos/", servePhoto(photosDir))
+	// Photo actions (favorite, face-tags) and photo serving (instant, filesystem-based)
+	mux.HandleFunc("/api/photos/", handlePhotoActions(database, imp, photosDir))
 
 	// Health check
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -77,12 +159,56 @@ func main() {
 	log.Printf("   Local:   http://127.0.0.1:%s", port)
 	log.Printf("   Network: http://192.168.1.201:%s\n", port)
 
-	if err := http.ListenAndServe(addr, mux); err != nil {
+	server := &http.Server{
+		Addr:        addr,
+		Handler:     mux,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		log.Printf("🛑 Shutting down...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("⚠️  Shutdown: %v", err)
+		}
+	}()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal(err)
 	}
+
+	// A scan still running has not started the watcher, and is cut short
+	// when the process exits
+	select {
+	case watcher, ok := <-watchers:
+		if ok {
+			if err := watcher.Close(); err != nil {
+				log.Printf("⚠️  Failed to close watcher: %v", err)
+			}
+		}
+	default:
+	}
+}
+
+// handleImportProgress reports the progress of the current or most recent
+// library scan
+func handleImportProgress(imp *importer.Importer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(imp.Progress())
+	}
 }
 
-// serveThumbnail serves pre-generated 284px WebP thumbnails
+// serveThumbnail serves pre-generated 284px thumbnails. Most are WebP, but
+// the built-in generator writes JPEG under the same name, so the type is
+// sniffed from the file.
 func serveThumbnail(thumbDir string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Extract photo ID from path /api/thumbnails/{id}
@@ -90,22 +216,38 @@ func serveThumbnail(thumbDir string) http.HandlerFunc {
 
 		thumbPath := filepath.Join(thumbDir, photoID+".webp")
 
-		// Check if thumbnail exists
-		if _, err := os.Stat(thumbPath); os.IsNotExist(err) {
+		f, err := os.Open(thumbPath)
+		if os.IsNotExist(err) {
 			http.Error(w, "Thumbnail not found", http.StatusNotFound)
 			return
 		}
+		if err != nil {
+			log.Printf("❌ Failed to open thumbnail %s: %v", thumbPath, err)
+			http.Error(w, "Failed to read thumbnail", http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			http.Error(w, "Failed to read thumbnail", http.StatusInternalServerError)
+			return
+		}
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(f, head)
 
 		// Serve with aggressive caching (1 year)
-		w.Header().Set("Content-Type", "image/webp")
+		w.Header().Set("Content-Type", http.DetectContentType(head[:n]))
 		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
 
-		http.ServeFile(w, r, thumbPath)
+		http.ServeContent(w, r, "", info.ModTime(), f)
 	}
 }
 
-// servePhoto serves full-size photos directly from filesystem
-func servePhoto(photosDir string) http.HandlerFunc {
+// servePhoto serves full-size photos directly from filesystem. Formats
+// browsers can't display, like HEIC, are transcoded to WebP or JPEG unless
+// the browser lists them in Accept; ?original=1 always serves the file as is.
+func servePhoto(database *db.DB, imp *importer.Importer, photosDir string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Extract photo path from /api/photos/{id}/full or /api/photos/{filename}
 		photoPath := r.URL.Path[len("/api/photos/"):]
@@ -124,16 +266,13 @@ func servePhoto(photosDir string) http.HandlerFunc {
 			return
 		}
 
-		// Detect content type from extension
-		contentType := "image/jpeg"
-		ext := filepath.Ext(fullPath)
-		switch ext {
-		case ".png":
-			contentType = "image/png"
-		case ".heic", ".HEIC":
-			contentType = "image/heic"
-		case ".webp":
-			contentType = "image/webp"
+		contentType := mediaContentType(fullPath)
+
+		if importer.NeedsTranscode(fullPath) && r.URL.Query().Get("original") != "1" {
+			w.Header().Set("Vary", "Accept")
+			if !acceptsType(r.Header.Get("Accept"), contentType) && serveTranscode(database, imp, fullPath, w, r) {
+				return
+			}
 		}
 
 		// Serve with moderate caching (1 day)
@@ -144,6 +283,77 @@ func servePhoto(photosDir string) http.HandlerFunc {
 	}
 }
 
+// mediaContentType detects a library file's content type from its extension
+func mediaContentType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return "image/png"
+	case ".heic":
+		return "image/heic"
+	case ".webp":
+		return "image/webp"
+	case ".mov":
+		return "video/quicktime"
+	case ".mp4", ".m4v":
+		return "video/mp4"
+	case ".dng":
+		return "image/x-adobe-dng"
+	case ".cr2":
+		return "image/x-canon-cr2"
+	case ".nef":
+		return "image/x-nikon-nef"
+	case ".arw":
+		return "image/x-sony-arw"
+	case ".raf":
+		return "image/x-fuji-raf"
+	}
+	return "image/jpeg"
+}
+
+// serveTranscode serves a browser-friendly copy of the photo at path. It
+// returns false, having written nothing, when the photo isn't in the library
+// or can't be transcoded, so the caller can fall back to the original.
+func serveTranscode(database *db.DB, imp *importer.Importer, path string, w http.ResponseWriter, r *http.Request) bool {
+	photo, err := database.GetPhotoByPath(path)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting photo %s: %v", path, err)
+		}
+		return false
+	}
+
+	// AVIF encodes too slowly for full-size photos
+	var formats []importer.ImageFormat
+	for _, f := range acceptedImageFormats(r.Header.Get("Accept")) {
+		if f != importer.FormatAVIF {
+			formats = append(formats, f)
+		}
+	}
+
+	transcoded, format, err := imp.Transcode(photo, formats)
+	if err != nil {
+		log.Printf("⚠️  Failed to transcode %s, serving the original: %v", photo.Filename, err)
+		return false
+	}
+
+	f, err := os.Open(transcoded)
+	if err != nil {
+		// Evicted since Transcode returned
+		return false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeContent(w, r, "", info.ModTime(), f)
+	return true
+}
+
 // isPathSafe checks if a path is within the allowed directory
 func isPathSafe(path, baseDir string) bool {
 	absPath, err := filepath.Abs(path)
@@ -172,43 +382,274 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-// listPhotos returns JSON list of all photos
+// PhotoResponse is the JSON shape of a photo, matching frontend expectations
+type PhotoResponse struct {
+	ID        int64              `json:"id"`
+	Name      string             `json:"name"`      // Frontend expects 'name' not 'filename'
+	Thumbnail string             `json:"thumbnail"` // Frontend expects 'thumbnail' not 'thumbnail_url'
+	Preview   string             `json:"preview"`   // ~1600px rendition for the fullscreen viewer
+	Date      string             `json:"date"`      // Frontend expects ISO date string
+	Favorite  bool               `json:"favorite"`
+	MediaType string             `json:"media_type"`           // "photo" or "video"
+	Duration  float64            `json:"duration,omitempty"`   // Seconds, for videos
+	Stream    string             `json:"stream,omitempty"`     // Range-aware video URL
+	LiveVideo string             `json:"live_video,omitempty"` // Motion of a Live Photo, streamed like a video
+	Originals []OriginalResponse `json:"originals,omitempty"`  // Files of a RAW+JPEG pair, JPEG first
+	Latitude  *float64           `json:"latitude,omitempty"`
+	Longitude *float64           `json:"longitude,omitempty"`
+	Place     string             `json:"place,omitempty"` // e.g. "Lisbon, Portugal"
+	Tags      []string           `json:"tags,omitempty"`
+}
+
+// OriginalResponse is one downloadable original file of a photo
+type OriginalResponse struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+func newPhotoResponse(photo db.Photo) PhotoResponse {
+	resp := PhotoResponse{
+		ID:        photo.ID,
+		Name:      photo.Filename,
+		Thumbnail: thumbnailURL(photo.ID, photo.ContentHash),
+		Preview:   versionedURL(fmt.Sprintf("/api/photos/%d/rendition/preview", photo.ID), photo.ContentHash),
+		Date:      photoDate(photo),
+		Favorite:  photo.Favorite,
+		MediaType: db.MediaPhoto,
+	}
+	if photo.MediaType != "" {
+		resp.MediaType = photo.MediaType
+	}
+	if resp.MediaType == db.MediaVideo {
+		resp.Duration = photo.Duration.Float64
+		resp.Stream = fmt.Sprintf("/api/photos/%d/stream", photo.ID)
+	}
+	if photo.LiveVideoID.Valid {
+		resp.LiveVideo = fmt.Sprintf("/api/photos/%d/stream", photo.LiveVideoID.Int64)
+	}
+	if photo.Latitude.Valid && photo.Longitude.Valid {
+		resp.Latitude, resp.Longitude = &photo.Latitude.Float64, &photo.Longitude.Float64
+	}
+	if photo.Country.Valid {
+		resp.Place = geocode.Place{Country: photo.Country.String, Region: photo.Region.String, City: photo.City.String}.Name()
+	}
+	if photo.RawID.Valid {
+		resp.Originals = []OriginalResponse{
+			{Name: photo.Filename, URL: fmt.Sprintf("/api/photos/%d/download", photo.ID)},
+			{Name: photo.RawFilename.String, URL: fmt.Sprintf("/api/photos/%d/download", photo.RawID.Int64)},
+		}
+	}
+	return resp
+}
+
+// thumbnailURL returns the thumbnail URL of a photo, versioned by its
+// content so cached thumbnails of edited files are not reused
+func thumbnailURL(id int64, hash sql.NullString) string {
+	return versionedURL(fmt.Sprintf("/api/thumbnails/%d", id), hash)
+}
+
+// versionedURL appends the start of a photo's content hash to the URL of an
+// image derived from it. Such images are cached as immutable, so the URL
+// changes with the content when the watcher picks up an edited file.
+func versionedURL(url string, hash sql.NullString) string {
+	if hash.Valid && len(hash.String) >= 8 {
+		url += "?v=" + hash.String[:8]
+	}
+	return url
+}
+
+func newPhotoResponses(photos []db.Photo) []PhotoResponse {
+	response := make([]PhotoResponse, len(photos))
+	for i, photo := range photos {
+		response[i] = newPhotoResponse(photo)
+	}
+	return response
+}
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// listPhotos returns photos matching the query filters, newest first.
+//
+// Filters: from/to (YYYY or YYYY-MM, inclusive), year and month, favorite,
+// person (ID), album (ID), camera (model), type (comma-separated
+// extensions), media_type (photo or video), near (lat,lon) with radius
+// (metres, default 1000), and country, region and city. Pagination follows
+// writePhotoPage.
 func listPhotos(database *db.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		photos, err := database.GetPhotos()
+		filter, err := parsePhotoFilter(r.URL.Query())
 		if err != nil {
-			http.Error(w, "Failed to get photos", http.StatusInternalServerError)
-			log.Printf("Error getting photos: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		// Convert to JSON-friendly format matching frontend expectations
-		type PhotoResponse struct {
-			ID        int64  `json:"id"`
-			Name      string `json:"name"`      // Frontend expects 'name' not 'filename'
-			Thumbnail string `json:"thumbnail"` // Frontend expects 'thumbnail' not 'thumbnail_url'
-			Date      string `json:"date"`      // Frontend expects ISO date string
-			Favorite  bool   `json:"favorite"`
-			Tags      []string `json:"tags,omitempty"`
+		writePhotoPage(w, r, database, filter)
+	}
+}
+
+// writePhotoPage responds with the photos matching filter, newest first. With
+// limit or cursor set in the query string the response is a page object with
+// next_cursor and total; otherwise it is the full array older clients expect.
+func writePhotoPage(w http.ResponseWriter, r *http.Request, database *db.DB, filter db.PhotoFilter) {
+	query := r.URL.Query()
+	paginated := query.Has("limit") || query.Has("cursor")
+
+	limit := 0
+	if paginated {
+		limit = defaultPageSize
+		if v := query.Get("limit"); v != "" {
+			var err error
+			limit, err = strconv.Atoi(v)
+			if err != nil || limit < 1 || limit > maxPageSize {
+				http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxPageSize), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	var after *db.PhotoCursor
+	if v := query.Get("cursor"); v != "" {
+		var err error
+		after, err = db.ParsePhotoCursor(v)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := database.ListPhotos(filter, after, limit)
+	if err != nil {
+		http.Error(w, "Failed to get photos", http.StatusInternalServerError)
+		log.Printf("Error getting photos: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if !paginated {
+		json.NewEncoder(w).Encode(newPhotoResponses(page.Photos))
+		return
+	}
+
+	var nextCursor *string
+	if page.Next != nil {
+		token := page.Next.String()
+		nextCursor = &token
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"photos":      newPhotoResponses(page.Photos),
+		"next_cursor": nextCursor,
+		"total":       page.Total,
+	})
+}
+
+// parsePhotoFilter reads listPhotos filters from the query string
+func parsePhotoFilter(query url.Values) (db.PhotoFilter, error) {
+	var filter db.PhotoFilter
+
+	if v := query.Get("favorite"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid favorite parameter")
 		}
+		filter.Favorite = &b
+	}
 
-		response := make([]PhotoResponse, len(photos))
-		for i, photo := range photos {
-			// Convert Unix timestamp to ISO 8601 date string
-			dateTime := time.Unix(photo.ImportedAt, 0)
+	from, to := query.Get("from"), query.Get("to")
+	if year := query.Get("year"); year != "" {
+		if month := query.Get("month"); month != "" {
+			m, err := strconv.Atoi(month)
+			if err != nil {
+				return filter, fmt.Errorf("invalid month parameter")
+			}
+			year = fmt.Sprintf("%s-%02d", year, m)
+		}
+		from, to = year, year
+	}
+	if from != "" {
+		start, _, err := parseMonthRange(from)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from parameter: %v", err)
+		}
+		filter.TakenFrom = start.Unix()
+	}
+	if to != "" {
+		_, end, err := parseMonthRange(to)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to parameter: %v", err)
+		}
+		filter.TakenBefore = end.Unix()
+	}
 
-			response[i] = PhotoResponse{
-				ID:        photo.ID,
-				Name:      photo.Filename,
-				Thumbnail: fmt.Sprintf("/api/thumbnails/%d", photo.ID),
-				Date:      dateTime.Format(time.RFC3339),
-				Favorite:  photo.Favorite,
+	for key, dest := range map[string]*int64{"person": &filter.PersonID, "album": &filter.AlbumID} {
+		if v := query.Get(key); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s parameter", key)
 			}
+			*dest = id
 		}
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+	filter.CameraModel = query.Get("camera")
+	filter.Country = query.Get("country")
+	filter.Region = query.Get("region")
+	filter.City = query.Get("city")
+
+	if v := query.Get("near"); v != "" {
+		near, err := parseNear(v, query.Get("radius"))
+		if err != nil {
+			return filter, err
+		}
+		filter.Near = near
+	}
+
+	switch v := query.Get("media_type"); v {
+	case "", db.MediaPhoto, db.MediaVideo:
+		filter.MediaType = v
+	default:
+		return filter, fmt.Errorf("invalid media_type parameter")
 	}
+
+	if v := query.Get("type"); v != "" {
+		for _, ext := range strings.Split(v, ",") {
+			if ext = strings.TrimSpace(ext); ext != "" {
+				filter.FileTypes = append(filter.FileTypes, ext)
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+// parseMonthRange parses YYYY or YYYY-MM into the half-open interval of local
+// time it covers
+func parseMonthRange(value string) (start, end time.Time, err error) {
+	if t, err := time.ParseInLocation("2006-01", value, time.Local); err == nil {
+		return t, t.AddDate(0, 1, 0), nil
+	}
+	if t, err := time.ParseInLocation("2006", value, time.Local); err == nil {
+		return t, t.AddDate(1, 0, 0), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("expected YYYY or YYYY-MM, got %q", value)
+}
+
+// photoDate returns when a photo was taken as an ISO 8601 string, in the
+// zone it was taken in when known. Photos not yet backfilled use import time.
+func photoDate(photo db.Photo) string {
+	if !photo.TakenAt.Valid {
+		return time.Unix(photo.ImportedAt, 0).Format(time.RFC3339)
+	}
+
+	t := time.Unix(photo.TakenAt.Int64, 0)
+	if photo.TakenOffset.Valid {
+		t = t.In(time.FixedZone("", int(photo.TakenOffset.Int64)))
+	}
+	return t.Format(time.RFC3339)
 }
 
 // handlePeople handles GET (list) and POST (create) for people
@@ -223,17 +664,23 @@ func handlePeople(database *db.DB) http.HandlerFunc {
 			}
 
 			type PersonResponse struct {
-				ID        int64  `json:"id"`
-				Name      string `json:"name"`
-				CreatedAt int64  `json:"created_at"`
+				ID         int64  `json:"id"`
+				Name       string `json:"name"`
+				CreatedAt  int64  `json:"created_at"`
+				PhotoCount int    `json:"photoCount"`
+				LastSeen   string `json:"lastSeen,omitempty"` // Date of their newest photo
 			}
 
 			response := make([]PersonResponse, len(people))
 			for i, person := range people {
 				response[i] = PersonResponse{
-					ID:        person.ID,
-					Name:      person.Name,
-					CreatedAt: person.CreatedAt,
+					ID:         person.ID,
+					Name:       person.Name,
+					CreatedAt:  person.CreatedAt,
+					PhotoCount: person.PhotoCount,
+				}
+				if person.LastSeen.Valid {
+					response[i].LastSeen = photoDate(db.Photo{TakenAt: person.LastSeen, TakenOffset: person.LastSeenOffset})
 				}
 			}
 
@@ -272,17 +719,42 @@ func handlePeople(database *db.DB) http.HandlerFunc {
 	}
 }
 
-// handlePersonActions handles PUT (update) and DELETE for specific people
+// handlePersonActions handles PUT (update) and DELETE for specific people,
+// and GET for /api/people/{id}/photos, the photos they are tagged in,
+// paginated as by listPhotos
 func handlePersonActions(database *db.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Extract person ID from path /api/people/{id}
-		idStr := r.URL.Path[len("/api/people/"):]
-		var personID int64
-		if _, err := fmt.Sscanf(idStr, "%d", &personID); err != nil {
+		idStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/people/"), "/")
+		personID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
 			http.Error(w, "Invalid person ID", http.StatusBadRequest)
 			return
 		}
 
+		if action == "photos" {
+			if r.Method != "GET" {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			_, err := database.GetPerson(personID)
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Person not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Failed to get person", http.StatusInternalServerError)
+				log.Printf("Error getting person %d: %v", personID, err)
+				return
+			}
+			writePhotoPage(w, r, database, db.PhotoFilter{PersonID: personID})
+			return
+		}
+		if action != "" {
+			http.Error(w, "Unknown person action", http.StatusNotFound)
+			return
+		}
+
 		switch r.Method {
 		case "PUT":
 			var req struct {
@@ -328,14 +800,27 @@ func handleFaceTags(database *db.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case "GET":
-			// Get face tags for a specific photo
-			photoFilename := r.URL.Query().Get("photo")
-			if photoFilename == "" {
-				http.Error(w, "photo parameter required", http.StatusBadRequest)
+			// Get face tags for a specific photo, by ID or by filename
+			ref := r.URL.Query().Get("photo_id")
+			if ref == "" {
+				ref = r.URL.Query().Get("photo")
+			}
+			if ref == "" {
+				http.Error(w, "photo_id or photo parameter required", http.StatusBadRequest)
+				return
+			}
+
+			photo, err := resolvePhoto(database, ref)
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Photo not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Failed to get photo", http.StatusInternalServerError)
 				return
 			}
 
-			tags, err := database.GetFaceTagsForPhoto(photoFilename)
+			tags, err := database.GetFaceTagsForPhoto(photo.ID)
 			if err != nil {
 				http.Error(w, "Failed to get face tags", http.StatusInternalServerError)
 				return
@@ -343,6 +828,7 @@ func handleFaceTags(database *db.DB) http.HandlerFunc {
 
 			type FaceTagResponse struct {
 				ID            int64   `json:"id"`
+				PhotoID       int64   `json:"photo_id"`
 				PhotoFilename string  `json:"photo_filename"`
 				PersonID      *int64  `json:"person_id,omitempty"`
 				X             float64 `json:"x"`
@@ -357,6 +843,7 @@ func handleFaceTags(database *db.DB) http.HandlerFunc {
 			for i, tag := range tags {
 				response[i] = FaceTagResponse{
 					ID:            tag.ID,
+					PhotoID:       tag.PhotoID,
 					PhotoFilename: tag.PhotoFilename,
 					X:             tag.X,
 					Y:             tag.Y,
@@ -375,6 +862,7 @@ func handleFaceTags(database *db.DB) http.HandlerFunc {
 
 		case "POST":
 			var req struct {
+				PhotoID       int64   `json:"photo_id"`
 				PhotoFilename string  `json:"photo_filename"`
 				PersonID      *int64  `json:"person_id,omitempty"`
 				X             float64 `json:"x"`
@@ -389,8 +877,23 @@ func handleFaceTags(database *db.DB) http.HandlerFunc {
 				return
 			}
 
-			if req.PhotoFilename == "" {
-				http.Error(w, "photo_filename is required", http.StatusBadRequest)
+			var photo *db.Photo
+			var err error
+			switch {
+			case req.PhotoID != 0:
+				photo, err = database.GetPhoto(req.PhotoID)
+			case req.PhotoFilename != "":
+				photo, err = database.GetPhotoByFilename(req.PhotoFilename)
+			default:
+				http.Error(w, "photo_id or photo_filename is required", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Photo not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Failed to get photo", http.StatusInternalServerError)
 				return
 			}
 
@@ -400,13 +903,17 @@ func handleFaceTags(database *db.DB) http.HandlerFunc {
 			}
 
 			id, err := database.InsertFaceTag(
-				req.PhotoFilename,
+				photo.ID,
 				req.PersonID,
 				req.X, req.Y,
 				req.Width, req.Height,
 				req.Confidence,
 				req.IsManual,
 			)
+			if errors.Is(err, db.ErrUnknownPerson) {
+				http.Error(w, "Person not found", http.StatusBadRequest)
+				return
+			}
 			if err != nil {
 				http.Error(w, "Failed to create face tag", http.StatusInternalServerError)
 				return
@@ -449,7 +956,12 @@ func handleFaceTagActions(database *db.DB) http.HandlerFunc {
 				return
 			}
 
-			if err := database.UpdateFaceTag(tagID, req.PersonID, req.X, req.Y, req.Width, req.Height, req.Confidence); err != nil {
+			err := database.UpdateFaceTag(tagID, req.PersonID, req.X, req.Y, req.Width, req.Height, req.Confidence)
+			if errors.Is(err, db.ErrUnknownPerson) {
+				http.Error(w, "Person not found", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
 				http.Error(w, "Failed to update face tag", http.StatusInternalServerError)
 				return
 			}
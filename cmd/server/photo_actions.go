@@ -0,0 +1,337 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/vieira/tidyphotos/internal/db"
+	"github.com/vieira/tidyphotos/internal/importer"
+)
+
+// photoActionHandler handles a sub-resource of an existing photo
+type photoActionHandler func(database *db.DB, photo *db.Photo, w http.ResponseWriter, r *http.Request)
+
+// photoActions maps /api/photos/{id|filename}/{action} to its handler
+var photoActions = map[string]photoActionHandler{
+	"favorite":  handleFavorite,
+	"face-tags": handlePhotoFaceTags,
+	"stream":    handleStream,
+	"download":  handleDownload,
+}
+
+// handlePhotoActions routes /api/photos/{id|filename}/{action} to the
+// matching photo action, /api/photos/{id|filename}/rendition/{name} to
+// serveRendition and everything else to servePhoto
+func handlePhotoActions(database *db.DB, imp *importer.Importer, photosDir string) http.HandlerFunc {
+	serve := servePhoto(database, imp, photosDir)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ref, name, ok := parseRenditionPath(r.URL); ok {
+			serveRendition(database, imp, ref, name, w, r)
+			return
+		}
+
+		ref, action, ok := parsePhotoAction(r.URL)
+		if !ok {
+			serve(w, r)
+			return
+		}
+
+		handler, ok := photoActions[action]
+		if !ok {
+			serve(w, r)
+			return
+		}
+
+		photo, err := resolvePhoto(database, ref)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Photo not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to get photo", http.StatusInternalServerError)
+			log.Printf("Error getting photo %s: %v", ref, err)
+			return
+		}
+
+		handler(database, photo, w, r)
+	}
+}
+
+// resolvePhoto looks a photo up by numeric ID, falling back to filename for
+// callers that still address photos by name. Imported files always have an
+// extension, so a bare number is never a filename.
+func resolvePhoto(database *db.DB, ref string) (*db.Photo, error) {
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		return database.GetPhoto(id)
+	}
+	return database.GetPhotoByFilename(ref)
+}
+
+// parsePhotoAction splits /api/photos/{id|filename}/{action} into its parts.
+// The escaped path is used so that filenames containing encoded slashes,
+// spaces or unicode are decoded exactly once.
+func parsePhotoAction(u *url.URL) (ref, action string, ok bool) {
+	rest, ok := strings.CutPrefix(u.EscapedPath(), "/api/photos/")
+	if !ok {
+		return "", "", false
+	}
+
+	i := strings.LastIndex(rest, "/")
+	if i <= 0 {
+		return "", "", false
+	}
+
+	ref, err := url.PathUnescape(rest[:i])
+	if err != nil {
+		return "", "", false
+	}
+
+	return ref, rest[i+1:], true
+}
+
+// handleFavorite handles PUT (set), DELETE (unset) and POST (toggle) of the
+// favorite flag on a photo
+func handleFavorite(database *db.DB, photo *db.Photo, w http.ResponseWriter, r *http.Request) {
+	var favorite bool
+	var err error
+	switch r.Method {
+	case "PUT":
+		favorite = true
+		err = database.SetFavorite(photo.ID, favorite)
+	case "DELETE":
+		favorite = false
+		err = database.SetFavorite(photo.ID, favorite)
+	case "POST":
+		favorite, err = database.ToggleFavorite(photo.ID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update favorite", http.StatusInternalServerError)
+		log.Printf("Error updating favorite for %s: %v", photo.Filename, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       photo.ID,
+		"name":     photo.Filename,
+		"favorite": favorite,
+	})
+}
+
+// handleStream serves a photo or video's original file with Range support,
+// so browsers can seek and start playback before the whole file downloads
+func handleStream(database *db.DB, photo *db.Photo, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	f, err := os.Open(photo.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "Photo file not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to read photo", http.StatusInternalServerError)
+		log.Printf("❌ Failed to open %s: %v", photo.Path, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Failed to read photo", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaContentType(photo.Path))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+
+	// ServeContent answers Range and If-Range requests with 206 responses
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// handleDownload serves a photo's original file as an attachment, under its
+// own filename
+func handleDownload(database *db.DB, photo *db.Photo, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": photo.Filename}))
+	handleStream(database, photo, w, r)
+}
+
+// handleBulkFavorites handles PUT (favorite) and DELETE (unfavorite) for a
+// list of photo IDs
+func handleBulkFavorites(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var favorite bool
+		switch r.Method {
+		case "PUT":
+			favorite = true
+		case "DELETE":
+			favorite = false
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			IDs []int64 `json:"ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if len(req.IDs) == 0 {
+			http.Error(w, "ids is required", http.StatusBadRequest)
+			return
+		}
+
+		updated, err := database.SetFavorites(req.IDs, favorite)
+		if err != nil {
+			http.Error(w, "Failed to update favorites", http.StatusInternalServerError)
+			log.Printf("Error updating favorites: %v", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"updated":  updated,
+			"favorite": favorite,
+		})
+	}
+}
+
+// photoFaceTagResponse is the camelCase face tag shape used by the fullscreen viewer
+type photoFaceTagResponse struct {
+	ID         int64   `json:"id"`
+	PhotoID    int64   `json:"photoId"`
+	PersonID   *int64  `json:"personId"`
+	PersonName *string `json:"personName,omitempty"`
+	X          float64 `json:"x"`
+	Y          float64 `json:"y"`
+	Width      float64 `json:"width"`
+	Height     float64 `json:"height"`
+	Confidence float64 `json:"confidence"`
+	IsManual   bool    `json:"isManual"`
+	CreatedAt  int64   `json:"createdAt"`
+}
+
+func newPhotoFaceTagResponse(tag db.FaceTag) photoFaceTagResponse {
+	resp := photoFaceTagResponse{
+		ID:         tag.ID,
+		PhotoID:    tag.PhotoID,
+		X:          tag.X,
+		Y:          tag.Y,
+		Width:      tag.Width,
+		Height:     tag.Height,
+		Confidence: tag.Confidence,
+		IsManual:   tag.IsManual,
+		CreatedAt:  tag.CreatedAt,
+	}
+	if tag.PersonID.Valid {
+		resp.PersonID = &tag.PersonID.Int64
+	}
+	if tag.PersonName.Valid {
+		resp.PersonName = &tag.PersonName.String
+	}
+	return resp
+}
+
+// handlePhotoFaceTags handles GET (list) and POST (create) of face tags on a photo
+func handlePhotoFaceTags(database *db.DB, photo *db.Photo, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		tags, err := database.GetFaceTagsForPhoto(photo.ID)
+		if err != nil {
+			http.Error(w, "Failed to get face tags", http.StatusInternalServerError)
+			log.Printf("Error getting face tags for %s: %v", photo.Filename, err)
+			return
+		}
+
+		response := make([]photoFaceTagResponse, len(tags))
+		for i, tag := range tags {
+			response[i] = newPhotoFaceTagResponse(tag)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"faceTags": response,
+		})
+
+	case "POST":
+		// Pointers distinguish missing fields from zero values
+		var req struct {
+			PersonID   *int64   `json:"personId"`
+			X          *float64 `json:"x"`
+			Y          *float64 `json:"y"`
+			Width      *float64 `json:"width"`
+			Height     *float64 `json:"height"`
+			Confidence *float64 `json:"confidence"`
+			IsManual   *bool    `json:"isManual"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if req.X == nil || req.Y == nil || req.Width == nil || req.Height == nil {
+			http.Error(w, "x, y, width and height are required", http.StatusBadRequest)
+			return
+		}
+
+		// Coordinates are percentages of the photo dimensions
+		if *req.X < 0 || *req.X > 100 || *req.Y < 0 || *req.Y > 100 ||
+			*req.Width <= 0 || *req.Width > 100 || *req.Height <= 0 || *req.Height > 100 {
+			http.Error(w, "Coordinates must be percentages between 0 and 100", http.StatusBadRequest)
+			return
+		}
+
+		confidence := 1.0
+		if req.Confidence != nil {
+			confidence = *req.Confidence
+		}
+		isManual := true
+		if req.IsManual != nil {
+			isManual = *req.IsManual
+		}
+
+		id, err := database.InsertFaceTag(photo.ID, req.PersonID, *req.X, *req.Y, *req.Width, *req.Height, confidence, isManual)
+		if errors.Is(err, db.ErrUnknownPerson) {
+			http.Error(w, "Person not found", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to create face tag", http.StatusInternalServerError)
+			log.Printf("Error creating face tag for %s: %v", photo.Filename, err)
+			return
+		}
+
+		tag, err := database.GetFaceTag(id)
+		if err != nil {
+			http.Error(w, "Failed to get face tag", http.StatusInternalServerError)
+			log.Printf("Error getting face tag %d: %v", id, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"faceTag": newPhotoFaceTagResponse(*tag),
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vieira/tidyphotos/internal/db"
+)
+
+const (
+	maxZoom = 22
+
+	// defaultNearRadius is the radius of near searches without one, in metres
+	defaultNearRadius = 1000
+	maxNearRadius     = 20_000_000
+)
+
+// placeClusterResponse is one cluster of photos on the map
+type placeClusterResponse struct {
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
+	Count     int     `json:"count"`
+	PhotoID   int64   `json:"photo_id"`  // Most recent photo in the cluster
+	Thumbnail string  `json:"thumbnail"` // Its thumbnail, to show on the marker
+}
+
+// handlePlaces returns the located photos inside bbox (west,south,east,north
+// in degrees; the whole world by default) clustered for the given web map
+// zoom level (0-22, default 0). The listPhotos filters apply.
+func handlePlaces(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+
+		filter, err := parsePhotoFilter(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		box := db.BoundingBox{West: -180, South: -90, East: 180, North: 90}
+		if v := query.Get("bbox"); v != "" {
+			if box, err = parseBoundingBox(v); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		zoom := 0
+		if v := query.Get("zoom"); v != "" {
+			zoom, err = strconv.Atoi(v)
+			if err != nil || zoom < 0 || zoom > maxZoom {
+				http.Error(w, fmt.Sprintf("zoom must be between 0 and %d", maxZoom), http.StatusBadRequest)
+				return
+			}
+		}
+
+		clusters, err := database.ListPlaces(filter, box, zoom)
+		if err != nil {
+			http.Error(w, "Failed to get places", http.StatusInternalServerError)
+			log.Printf("Error getting places: %v", err)
+			return
+		}
+
+		response := make([]placeClusterResponse, len(clusters))
+		for i, c := range clusters {
+			response[i] = placeClusterResponse{
+				Latitude:  c.Latitude,
+				Longitude: c.Longitude,
+				Count:     c.Count,
+				PhotoID:   c.PhotoID,
+				Thumbnail: thumbnailURL(c.PhotoID, c.PhotoHash),
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"zoom":     zoom,
+			"clusters": response,
+		})
+	}
+}
+
+// placeNodeResponse is a country, region or city in the places tree. Counts
+// include photos named no more precisely than the node itself.
+type placeNodeResponse struct {
+	Name     string               `json:"name"`
+	Count    int                  `json:"count"`
+	Children []*placeNodeResponse `json:"children,omitempty"` // Regions of a country, cities of a region
+}
+
+// handlePlaceTree returns the named places of the photos matching the
+// listPhotos filters as a country → region → city tree with photo counts,
+// each level sorted by name
+func handlePlaceTree(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		filter, err := parsePhotoFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		places, err := database.CountPlaces(filter)
+		if err != nil {
+			http.Error(w, "Failed to get places", http.StatusInternalServerError)
+			log.Printf("Error counting places: %v", err)
+			return
+		}
+
+		// Rows arrive sorted, so each level only grows at its end
+		countries := []*placeNodeResponse{}
+		for _, p := range places {
+			country := lastPlaceNode(&countries, p.Country)
+			country.Count += p.Count
+			if p.Region == "" {
+				continue
+			}
+			region := lastPlaceNode(&country.Children, p.Region)
+			region.Count += p.Count
+			if p.City == "" {
+				continue
+			}
+			lastPlaceNode(&region.Children, p.City).Count += p.Count
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"countries": countries,
+		})
+	}
+}
+
+// lastPlaceNode returns the last node of nodes if it is named name, or
+// appends one that is
+func lastPlaceNode(nodes *[]*placeNodeResponse, name string) *placeNodeResponse {
+	if n := len(*nodes); n > 0 && (*nodes)[n-1].Name == name {
+		return (*nodes)[n-1]
+	}
+	node := &placeNodeResponse{Name: name}
+	*nodes = append(*nodes, node)
+	return node
+}
+
+// parseBoundingBox parses west,south,east,north in degrees
+func parseBoundingBox(value string) (db.BoundingBox, error) {
+	coords, err := parseCoordinates(value, 4)
+	if err != nil {
+		return db.BoundingBox{}, fmt.Errorf("invalid bbox parameter: %v", err)
+	}
+
+	box := db.BoundingBox{West: coords[0], South: coords[1], East: coords[2], North: coords[3]}
+	if !validLatitude(box.South) || !validLatitude(box.North) || box.South > box.North ||
+		!validLongitude(box.West) || !validLongitude(box.East) {
+		return db.BoundingBox{}, fmt.Errorf("invalid bbox parameter: expected west,south,east,north in degrees")
+	}
+	return box, nil
+}
+
+// parseNear parses the near (lat,lon) and radius (metres) parameters
+func parseNear(near, radius string) (*db.GeoCircle, error) {
+	coords, err := parseCoordinates(near, 2)
+	if err != nil || !validLatitude(coords[0]) || !validLongitude(coords[1]) {
+		return nil, fmt.Errorf("invalid near parameter: expected lat,lon in degrees")
+	}
+
+	circle := &db.GeoCircle{Latitude: coords[0], Longitude: coords[1], Radius: defaultNearRadius}
+	if radius != "" {
+		circle.Radius, err = strconv.ParseFloat(radius, 64)
+		if err != nil || circle.Radius <= 0 || circle.Radius > maxNearRadius {
+			return nil, fmt.Errorf("radius must be between 0 and %d metres", maxNearRadius)
+		}
+	}
+	return circle, nil
+}
+
+// parseCoordinates parses n comma-separated numbers
+func parseCoordinates(value string, n int) ([]float64, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("expected %d comma-separated numbers", n)
+	}
+
+	coords := make([]float64, n)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+		coords[i] = v
+	}
+	return coords, nil
+}
+
+func validLatitude(v float64) bool  { return v >= -90 && v <= 90 }
+func validLongitude(v float64) bool { return v >= -180 && v <= 180 }
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vieira/tidyphotos/internal/db"
+	"github.com/vieira/tidyphotos/internal/importer"
+)
+
+// parseRenditionPath splits /api/photos/{id|filename}/rendition/{name} into
+// its parts
+func parseRenditionPath(u *url.URL) (ref, name string, ok bool) {
+	rest, ok := strings.CutPrefix(u.EscapedPath(), "/api/photos/")
+	if !ok {
+		return "", "", false
+	}
+
+	i := strings.LastIndex(rest, "/rendition/")
+	if i <= 0 {
+		return "", "", false
+	}
+
+	ref, err := url.PathUnescape(rest[:i])
+	if err != nil {
+		return "", "", false
+	}
+
+	name = rest[i+len("/rendition/"):]
+	return ref, name, name != "" && !strings.Contains(name, "/")
+}
+
+// serveRendition serves a photo resized to a named rendition (grid, grid2x,
+// preview, preview2x), generating it on first request. The format is
+// negotiated from the Accept header: AVIF or WebP when the browser lists
+// them, JPEG otherwise.
+func serveRendition(database *db.DB, imp *importer.Importer, ref, name string, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	photo, err := resolvePhoto(database, ref)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Photo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get photo", http.StatusInternalServerError)
+		log.Printf("Error getting photo %s: %v", ref, err)
+		return
+	}
+
+	path, format, err := imp.Rendition(photo, name, acceptedImageFormats(r.Header.Get("Accept")))
+	switch {
+	case errors.Is(err, importer.ErrUnknownRendition):
+		http.Error(w, "Unknown rendition", http.StatusNotFound)
+		return
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, "Photo file not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, "Failed to render photo", http.StatusInternalServerError)
+		log.Printf("⚠️  Failed to render %s of %s: %v", name, photo.Filename, err)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "Failed to read rendition", http.StatusInternalServerError)
+		log.Printf("❌ Failed to open rendition %s: %v", path, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Failed to read rendition", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Vary", "Accept")
+	// Versioned URLs change with the photo's content, like thumbnails
+	if r.URL.Query().Has("v") {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	}
+
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// acceptedImageFormats lists the rendition formats an Accept header allows,
+// best first. AVIF and WebP are ranked by their q value, then by compression,
+// and JPEG is always acceptable as a last resort. Wildcards don't count for
+// the newer formats, since browsers that support them say so explicitly.
+func acceptedImageFormats(accept string) []importer.ImageFormat {
+	q := map[importer.ImageFormat]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		weight := 1.0
+		if v, ok := params["q"]; ok {
+			if weight, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case "image/avif":
+			q[importer.FormatAVIF] = weight
+		case "image/webp":
+			q[importer.FormatWebP] = weight
+		}
+	}
+
+	formats := []importer.ImageFormat{importer.FormatAVIF, importer.FormatWebP}
+	accepted := formats[:0]
+	for _, f := range formats {
+		if q[f] > 0 {
+			accepted = append(accepted, f)
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return q[accepted[i]] > q[accepted[j]]
+	})
+
+	return append(accepted, importer.FormatJPEG)
+}
+
+// acceptsType reports whether an Accept header explicitly lists a media type
+func acceptsType(accept, mediaType string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		t, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || t != mediaType {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if v, err := strconv.ParseFloat(q, 64); err != nil || v <= 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/vieira/tidyphotos/internal/db"
+	"github.com/vieira/tidyphotos/internal/phash"
+)
+
+const (
+	// defaultSimilarityThreshold is the largest Hamming distance between
+	// 64-bit dHashes still treated as the same picture
+	defaultSimilarityThreshold = 10
+	maxSimilarityThreshold     = 32
+)
+
+// parseSimilarityThreshold reads the threshold query parameter
+func parseSimilarityThreshold(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("threshold")
+	if v == "" {
+		return defaultSimilarityThreshold, nil
+	}
+
+	threshold, err := strconv.Atoi(v)
+	if err != nil || threshold < 0 || threshold > maxSimilarityThreshold {
+		return 0, fmt.Errorf("threshold must be between 0 and %d", maxSimilarityThreshold)
+	}
+	return threshold, nil
+}
+
+// handleSimilarClusters lists groups of visually similar photos, such as
+// burst shots and re-saved edits
+func handleSimilarClusters(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		threshold, err := parseSimilarityThreshold(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		hashes, err := database.GetPerceptualHashes()
+		if err != nil {
+			http.Error(w, "Failed to get perceptual hashes", http.StatusInternalServerError)
+			log.Printf("Error getting perceptual hashes: %v", err)
+			return
+		}
+
+		entries := make([]phash.Entry, len(hashes))
+		for i, h := range hashes {
+			entries[i] = phash.Entry{ID: h.PhotoID, Hash: h.Hash}
+		}
+		clusters := phash.Cluster(entries, threshold)
+
+		var ids []int64
+		for _, cluster := range clusters {
+			ids = append(ids, cluster...)
+		}
+		photos, err := database.GetPhotosByIDs(ids)
+		if err != nil {
+			http.Error(w, "Failed to get photos", http.StatusInternalServerError)
+			log.Printf("Error getting photos: %v", err)
+			return
+		}
+
+		response := make([][]PhotoResponse, 0, len(clusters))
+		for _, cluster := range clusters {
+			group := make([]PhotoResponse, 0, len(cluster))
+			for _, id := range cluster {
+				if photo, ok := photos[id]; ok {
+					group = append(group, newPhotoResponse(photo))
+				}
+			}
+			response = append(response, group)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"threshold": threshold,
+			"clusters":  response,
+		})
+	}
+}
+
+// handleSimilarPhotos lists photos that look like /api/similar/{id}, closest first
+func handleSimilarPhotos(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		idStr := r.URL.Path[len("/api/similar/"):]
+		var photoID int64
+		if _, err := fmt.Sscanf(idStr, "%d", &photoID); err != nil {
+			http.Error(w, "Invalid photo ID", http.StatusBadRequest)
+			return
+		}
+
+		threshold, err := parseSimilarityThreshold(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		photo, err := database.GetPhoto(photoID)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Photo not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to get photo", http.StatusInternalServerError)
+			return
+		}
+
+		type SimilarPhoto struct {
+			PhotoResponse
+			Distance int `json:"distance"`
+		}
+
+		similar := []SimilarPhoto{}
+
+		// Photos without a thumbnail yet have no hash and match nothing
+		if photo.PHash.Valid {
+			hashes, err := database.GetPerceptualHashes()
+			if err != nil {
+				http.Error(w, "Failed to get perceptual hashes", http.StatusInternalServerError)
+				log.Printf("Error getting perceptual hashes: %v", err)
+				return
+			}
+
+			// A linear scan of 64-bit popcounts is fast enough for one query
+			target := uint64(photo.PHash.Int64)
+			distances := make(map[int64]int)
+			var ids []int64
+			for _, h := range hashes {
+				if h.PhotoID == photo.ID {
+					continue
+				}
+				if d := phash.Distance(target, h.Hash); d <= threshold {
+					distances[h.PhotoID] = d
+					ids = append(ids, h.PhotoID)
+				}
+			}
+
+			photos, err := database.GetPhotosByIDs(ids)
+			if err != nil {
+				http.Error(w, "Failed to get photos", http.StatusInternalServerError)
+				log.Printf("Error getting photos: %v", err)
+				return
+			}
+
+			for _, id := range ids {
+				if p, ok := photos[id]; ok {
+					similar = append(similar, SimilarPhoto{
+						PhotoResponse: newPhotoResponse(p),
+						Distance:      distances[id],
+					})
+				}
+			}
+			sort.SliceStable(similar, func(i, j int) bool {
+				return similar[i].Distance < similar[j].Distance
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"photo":     newPhotoResponse(*photo),
+			"threshold": threshold,
+			"similar":   similar,
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vieira/tidyphotos/internal/db"
+)
+
+// smartAlbumResponse is the JSON shape of a smart album. The photo count and
+// cover are only evaluated for a single album; RuleError is set instead when
+// its stored rule no longer compiles.
+type smartAlbumResponse struct {
+	ID         int64              `json:"id"`
+	Name       string             `json:"name"`
+	Rule       json.RawMessage    `json:"rule"`
+	RuleError  *ruleErrorResponse `json:"rule_error,omitempty"`
+	PhotoCount *int               `json:"photo_count,omitempty"`
+	Cover      string             `json:"cover,omitempty"` // Thumbnail of the newest photo
+	CreatedAt  int64              `json:"created_at"`
+	UpdatedAt  int64              `json:"updated_at"`
+}
+
+func newSmartAlbumResponse(album db.SmartAlbum, evaluated bool) smartAlbumResponse {
+	resp := smartAlbumResponse{
+		ID:        album.ID,
+		Name:      album.Name,
+		CreatedAt: album.CreatedAt,
+		UpdatedAt: album.UpdatedAt,
+	}
+	if json.Valid([]byte(album.RuleSource)) {
+		resp.Rule = json.RawMessage(album.RuleSource)
+	}
+	if album.Rule == nil {
+		resp.RuleError = asRuleError(album.RuleError)
+		return resp
+	}
+	if evaluated {
+		resp.PhotoCount = &album.PhotoCount
+		if album.CoverID.Valid {
+			resp.Cover = thumbnailURL(album.CoverID.Int64, album.CoverHash)
+		}
+	}
+	return resp
+}
+
+// ruleErrorResponse is the JSON shape of a rule that does not compile, with
+// the JSON Pointer of the clause at fault
+type ruleErrorResponse struct {
+	Error string `json:"error"`
+	Path  string `json:"path"`
+}
+
+// asRuleError describes a rule compile error, normally a *db.RuleError
+func asRuleError(err error) *ruleErrorResponse {
+	var ruleErr *db.RuleError
+	if !errors.As(err, &ruleErr) {
+		return &ruleErrorResponse{Error: err.Error()}
+	}
+	return &ruleErrorResponse{Error: ruleErr.Error(), Path: ruleErr.Path}
+}
+
+// handleSmartAlbums handles GET (list) and POST (create) for smart albums,
+// which take a name and a rule (see db.Rule)
+func handleSmartAlbums(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			albums, err := database.GetSmartAlbums()
+			if err != nil {
+				http.Error(w, "Failed to get smart albums", http.StatusInternalServerError)
+				log.Printf("Error getting smart albums: %v", err)
+				return
+			}
+
+			response := make([]smartAlbumResponse, len(albums))
+			for i, album := range albums {
+				response[i] = newSmartAlbumResponse(album, false)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
+
+		case "POST":
+			var req struct {
+				Name string          `json:"name"`
+				Rule json.RawMessage `json:"rule"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request", http.StatusBadRequest)
+				return
+			}
+
+			req.Name = strings.TrimSpace(req.Name)
+			if req.Name == "" {
+				http.Error(w, "Name is required", http.StatusBadRequest)
+				return
+			}
+			if req.Rule == nil {
+				http.Error(w, "Rule is required", http.StatusBadRequest)
+				return
+			}
+			rule, err := db.ParseRule(req.Rule)
+			if err != nil {
+				writeSmartAlbumError(w, "Invalid rule", err)
+				return
+			}
+
+			id, err := database.InsertSmartAlbum(req.Name, rule)
+			if err != nil {
+				writeSmartAlbumError(w, "Failed to create smart album", err)
+				return
+			}
+
+			writeSmartAlbum(w, database, id, http.StatusCreated)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// handleSmartAlbumActions handles GET, PUT (name and/or rule) and DELETE for
+// /api/smart-albums/{id}, and GET for /api/smart-albums/{id}/photos, the
+// photos matching its rule now, paginated as by listPhotos
+func handleSmartAlbumActions(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/smart-albums/"), "/")
+		albumID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid smart album ID", http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case action == "photos" && r.Method == "GET":
+			album, err := database.GetSmartAlbum(albumID)
+			if err != nil {
+				writeSmartAlbumError(w, "Failed to get smart album", err)
+				return
+			}
+			if album.Rule == nil {
+				writeRuleError(w, http.StatusConflict, asRuleError(album.RuleError))
+				return
+			}
+			writePhotoPage(w, r, database, db.PhotoFilter{Rule: album.Rule})
+
+		case action == "photos":
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+
+		case action != "":
+			http.Error(w, "Unknown smart album action", http.StatusNotFound)
+
+		case r.Method == "GET":
+			writeSmartAlbum(w, database, albumID, http.StatusOK)
+
+		case r.Method == "PUT":
+			var req struct {
+				Name *string         `json:"name"`
+				Rule json.RawMessage `json:"rule"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request", http.StatusBadRequest)
+				return
+			}
+
+			album, err := database.GetSmartAlbum(albumID)
+			if err != nil {
+				writeSmartAlbumError(w, "Failed to get smart album", err)
+				return
+			}
+
+			name, rule := album.Name, album.Rule
+			if req.Name != nil {
+				name = strings.TrimSpace(*req.Name)
+				if name == "" {
+					http.Error(w, "Name is required", http.StatusBadRequest)
+					return
+				}
+			}
+			if req.Rule != nil {
+				if rule, err = db.ParseRule(req.Rule); err != nil {
+					writeSmartAlbumError(w, "Invalid rule", err)
+					return
+				}
+			} else if rule == nil {
+				// The stored rule no longer compiles and can't be kept
+				writeRuleError(w, http.StatusConflict, asRuleError(album.RuleError))
+				return
+			}
+			if err := database.UpdateSmartAlbum(albumID, name, rule); err != nil {
+				writeSmartAlbumError(w, "Failed to update smart album", err)
+				return
+			}
+
+			writeSmartAlbum(w, database, albumID, http.StatusOK)
+
+		case r.Method == "DELETE":
+			if err := database.DeleteSmartAlbum(albumID); err != nil {
+				writeSmartAlbumError(w, "Failed to delete smart album", err)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// writeSmartAlbum responds with a smart album
+func writeSmartAlbum(w http.ResponseWriter, database *db.DB, albumID int64, status int) {
+	album, err := database.GetSmartAlbum(albumID)
+	if err != nil {
+		writeSmartAlbumError(w, "Failed to get smart album", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(newSmartAlbumResponse(*album, true))
+}
+
+// writeSmartAlbumError maps smart album errors to responses, logging
+// unexpected ones under message. Rule errors carry the JSON Pointer of the
+// clause at fault.
+func writeSmartAlbumError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Smart album not found", http.StatusNotFound)
+	case errors.Is(err, db.ErrAlbumNameTaken):
+		http.Error(w, "A smart album with this name already exists", http.StatusConflict)
+	case errors.As(err, new(*db.RuleError)):
+		writeRuleError(w, http.StatusBadRequest, asRuleError(err))
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+		log.Printf("%s: %v", message, err)
+	}
+}
+
+// writeRuleError responds with a rule error and the JSON Pointer of the clause
+// at fault: 400 for a rule in the request, 409 for a stored one that no longer
+// compiles
+func writeRuleError(w http.ResponseWriter, status int, ruleErr *ruleErrorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ruleErr)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vieira/tidyphotos/internal/db"
+	"github.com/vieira/tidyphotos/internal/importer"
+)
+
+const usage = `Usage: tidyphotos <command> [arguments]
+
+Commands:
+  migrate status       Show applied and pending schema migrations
+  migrate up           Apply all pending schema migrations
+  migrate down [-steps N]
+                       Revert the N most recent migrations (default 1)
+  duplicates           Report photos whose files have identical content
+  reconcile [-prune] [-grace DURATION]
+                       Flag photos missing from disk, relink moved files and
+                       remove orphan thumbnails. With -prune, delete photos
+                       missing for longer than the grace period (default 720h)
+
+Environment:
+  DB_PATH              Database file (default photos.db)
+  PHOTOS_DIR           Photo library (default test_photos)
+  CACHE_DIR            Thumbnail cache (default cache)
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	dbPath := getEnv("DB_PATH", "photos.db")
+
+	var err error
+	switch os.Args[1] {
+	case "migrate":
+		err = runMigrate(dbPath, os.Args[2:])
+	case "duplicates":
+		err = runDuplicates(dbPath)
+	case "reconcile":
+		err = runReconcile(dbPath, os.Args[2:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runMigrate implements `tidyphotos migrate status|up|down`
+func runMigrate(dbPath string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("migrate requires one of: status, up, down")
+	}
+
+	database, err := db.OpenUnmigrated(dbPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	switch args[0] {
+	case "status":
+		status, err := database.MigrationStatus()
+		if err != nil {
+			return err
+		}
+
+		current, err := database.SchemaVersion()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Database: %s\n", dbPath)
+		fmt.Printf("Schema version: %d (binary supports %d)\n\n", current, db.LatestSchemaVersion())
+		for _, m := range status {
+			state := "pending"
+			if m.Applied {
+				state = "applied " + time.Unix(m.AppliedAt, 0).Format(time.RFC3339)
+			}
+			fmt.Printf("  %4d  %-40s %s\n", m.Version, m.Name, state)
+		}
+		if current > db.LatestSchemaVersion() {
+			fmt.Printf("\n⚠️  Database is newer than this binary; upgrade tidyphotos before using it\n")
+		}
+		return nil
+
+	case "up":
+		applied, err := database.MigrateUp()
+		if err != nil {
+			return err
+		}
+		log.Printf("✅ Applied %d migration(s), schema at version %d", applied, db.LatestSchemaVersion())
+		return nil
+
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ExitOnError)
+		steps := fs.Int("steps", 1, "number of migrations to revert")
+		fs.Parse(args[1:])
+
+		reverted, err := database.MigrateDown(*steps)
+		if err != nil {
+			return err
+		}
+
+		current, err := database.SchemaVersion()
+		if err != nil {
+			return err
+		}
+		log.Printf("✅ Reverted %d migration(s), schema at version %d", reverted, current)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate command: %s", args[0])
+	}
+}
+
+// runDuplicates implements `tidyphotos duplicates`
+func runDuplicates(dbPath string) error {
+	database, err := db.Open(dbPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	groups, err := database.GetDuplicateGroups()
+	if err != nil {
+		return err
+	}
+
+	if len(groups) == 0 {
+		fmt.Println("No exact duplicates found")
+		return nil
+	}
+
+	var wasted int64
+	for _, group := range groups {
+		fmt.Printf("%s  %s x%d\n", group.ContentHash[:12], formatBytes(group.FileSize), len(group.Photos))
+		for _, photo := range group.Photos {
+			fmt.Printf("    [%d] %s\n", photo.ID, photo.Path)
+		}
+		wasted += group.FileSize * int64(len(group.Photos)-1)
+	}
+
+	fmt.Printf("\n%d duplicate groups, %s reclaimable\n", len(groups), formatBytes(wasted))
+	return nil
+}
+
+// runReconcile implements `tidyphotos reconcile [-prune] [-grace DURATION]`
+func runReconcile(dbPath string, args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	prune := fs.Bool("prune", false, "delete photos missing for longer than the grace period")
+	grace := fs.Duration("grace", 30*24*time.Hour, "how long a photo may be missing before -prune deletes it")
+	fs.Parse(args)
+
+	if *prune && *grace <= 0 {
+		return fmt.Errorf("-grace must be positive")
+	}
+
+	database, err := db.Open(dbPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	thumbDir := filepath.Join(getEnv("CACHE_DIR", "cache"), "thumbnails")
+	imp := importer.New(database, getEnv("PHOTOS_DIR", "test_photos"), thumbDir)
+	defer imp.Close()
+
+	var pruneAfter time.Duration
+	if *prune {
+		pruneAfter = *grace
+	}
+
+	stats, err := imp.Reconcile(pruneAfter)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Newly missing:       %d\n", stats.Missing)
+	fmt.Printf("Restored:            %d\n", stats.Restored)
+	fmt.Printf("Relinked:            %d\n", stats.Relinked)
+	if *prune {
+		fmt.Printf("Pruned:              %d\n", stats.Pruned)
+	}
+	fmt.Printf("Thumbnails removed:  %d\n", stats.ThumbnailsPurged)
+
+	missing, err := database.GetMissingPhotos()
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		fmt.Printf("\n%d photos missing from disk:\n", len(missing))
+		for _, photo := range missing {
+			since := time.Unix(photo.MissingSince.Int64, 0).Format(time.RFC3339)
+			fmt.Printf("    [%d] %s (since %s)\n", photo.ID, photo.Path, since)
+		}
+	}
+	return nil
+}
+
+// formatBytes renders a byte count with a binary unit suffix
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -73,10 +73,16 @@ export class FullscreenViewer {
     }
 
     openFullScreenFromRoute(photoId: number): void {
-        // Wait for photos to load if needed
-        if (this.app.getPhotoManager().isLoading) {
+        // Wait for photos to load if needed, until the page holding this one
+        // arrives or every page has
+        const isPending = (): boolean => {
+            const photoManager = this.app.getPhotoManager();
+            return photoManager.isLoading ||
+                (photoManager.isLoadingMore && !photoManager.allPhotos.some(p => p.id === photoId));
+        };
+        if (isPending()) {
             const checkPhotos = (): void => {
-                if (!this.app.getPhotoManager().isLoading) {
+                if (!isPending()) {
                     this.openFullScreenById(photoId);
                 } else {
                     setTimeout(checkPhotos, 100);
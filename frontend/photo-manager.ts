@@ -1,13 +1,22 @@
-import { Photo } from "./types.js";
+import { Photo, PhotoPage } from "./types.js";
+
+// Photos requested per page; the grid renders after the first one
+const PAGE_SIZE = 200;
 
 export class PhotoManager {
   private photos: Photo[] = [];
   private loading: boolean = true;
+  private loadingMore: boolean = false;
 
   get isLoading(): boolean {
     return this.loading;
   }
 
+  // True while pages after the first are still being fetched
+  get isLoadingMore(): boolean {
+    return this.loadingMore;
+  }
+
   get allPhotos(): Photo[] {
     return this.photos;
   }
@@ -15,13 +24,18 @@ export class PhotoManager {
   async loadPhotos(): Promise<void> {
     console.log("📡 TidyPhotos: Loading photos from API...");
     try {
-      const response = await fetch("/api/photos");
-      const data = await response.json();
-      if (!response.ok) {
-        throw new Error(`API error: ${response.status} ${response.statusText}`);
-      }
+      // Show the first page as soon as it arrives, then page through the
+      // rest of the library in the background
+      let page = await this.fetchPage(null);
+      this.photos = page.photos;
+      this.loading = false;
 
-      this.photos = data as Photo[];
+      this.loadingMore = page.next_cursor !== null;
+      while (page.next_cursor !== null) {
+        page = await this.fetchPage(page.next_cursor);
+        this.photos = this.photos.concat(page.photos);
+      }
+      this.loadingMore = false;
 
       // // Mock data for now
       // if (this.photos.length === 0) {
@@ -29,13 +43,29 @@ export class PhotoManager {
       //   this.photos = this.generateMockPhotos();
       // }
 
-      this.loading = false;
       console.log("✅ TidyPhotos: Photos loaded successfully");
     } catch (error) {
       console.error("❌ TidyPhotos: Failed to load photos:", error);
-      this.photos = this.generateMockPhotos();
+      // Keep the pages already shown
+      if (this.photos.length === 0) {
+        this.photos = this.generateMockPhotos();
+      }
       this.loading = false;
+      this.loadingMore = false;
+    }
+  }
+
+  private async fetchPage(cursor: string | null): Promise<PhotoPage> {
+    let url = `/api/photos?limit=${PAGE_SIZE}`;
+    if (cursor !== null) {
+      url += `&cursor=${encodeURIComponent(cursor)}`;
+    }
+
+    const response = await fetch(url);
+    if (!response.ok) {
+      throw new Error(`API error: ${response.status} ${response.statusText}`);
     }
+    return (await response.json()) as PhotoPage;
   }
 
   private generateMockPhotos(): Photo[] {
@@ -4,12 +4,82 @@ export interface Photo {
     id: number;
     name: string;
     thumbnail: string;
+    preview?: string;
     date: string;
     favorite: boolean;
+    media_type?: 'photo' | 'video';
+    duration?: number;
+    stream?: string;
+    live_video?: string;
+    originals?: { name: string; url: string }[];
+    latitude?: number;
+    longitude?: number;
+    place?: string;
     tags?: string[];
     people?: Person[];
 }
 
+// A page of GET /api/photos with limit or cursor set; next_cursor is null on
+// the last page
+export interface PhotoPage {
+    photos: Photo[];
+    next_cursor: string | null;
+    total: number;
+}
+
+export interface PlaceNode {
+    name: string;
+    count: number;
+    children?: PlaceNode[];
+}
+
+export interface Album {
+    id: number;
+    name: string;
+    description?: string;
+    photo_count: number;
+    cover_photo_id?: number;
+    cover?: string;
+    created_at: number;
+    updated_at: number;
+    photos?: Photo[];
+}
+
+// A JSON predicate over photos, e.g.
+// {"all": [{"favorite": true}, {"person": "Ana"}, {"year": 2022}]}
+export type SmartAlbumRule = Record<string, unknown>;
+
+// photo_count and cover are only evaluated by GET /api/smart-albums/{id};
+// rule_error is set instead when the stored rule no longer compiles
+export interface SmartAlbum {
+    id: number;
+    name: string;
+    rule: SmartAlbumRule;
+    rule_error?: SmartAlbumRuleError;
+    photo_count?: number;
+    cover?: string;
+    created_at: number;
+    updated_at: number;
+}
+
+// Returned with status 400 for a rule that does not compile, or 409 for a
+// stored one that no longer does; path is the JSON Pointer of the clause at
+// fault, e.g. "/all/2/year"
+export interface SmartAlbumRuleError {
+    error: string;
+    path: string;
+}
+
+export interface Folder {
+    path: string;
+    name: string;
+    parent?: string;
+    photo_count: number;
+    cover?: string;
+    folders?: Folder[];
+    photos?: Photo[];
+}
+
 export interface Person {
     id: number;
     name: string;
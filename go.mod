@@ -2,7 +2,11 @@ module github.com/vieira/tidyphotos
 
 go 1.24.3
 
-require modernc.org/sqlite v1.39.1
+require (
+	github.com/fsnotify/fsnotify v1.9.0
+	golang.org/x/image v0.25.0
+	modernc.org/sqlite v1.39.1
+)
 
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
@@ -0,0 +1,424 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrAlbumNameTaken is returned when another album already has the name
+	ErrAlbumNameTaken = errors.New("album name already taken")
+
+	// ErrNotInAlbum is returned for album operations on photos that are not
+	// members of the album
+	ErrNotInAlbum = errors.New("photo is not in the album")
+
+	// ErrUnknownPhoto is returned when adding photos that do not exist
+	ErrUnknownPhoto = errors.New("unknown photo")
+)
+
+// Album is a hand-picked, ordered set of photos
+type Album struct {
+	ID           int64
+	Name         string
+	Description  sql.NullString
+	CoverPhotoID sql.NullInt64 // Chosen cover; the first photo is shown otherwise
+	CreatedAt    int64
+	UpdatedAt    int64
+
+	// Computed when listing
+	PhotoCount int            // Members whose files are on disk
+	CoverID    sql.NullInt64  // The cover shown: the chosen one or the first photo
+	CoverHash  sql.NullString // Its content hash, to version the thumbnail URL
+}
+
+// albumColumns is the column list scanned by scanAlbum. Missing photos are
+// left out of counts and covers, as they are of listings.
+const albumColumns = `a.id, a.name, a.description, a.cover_photo_id, a.created_at, a.updated_at,
+	(SELECT COUNT(*) FROM album_photos ap JOIN photos p ON p.id = ap.photo_id
+		WHERE ap.album_id = a.id AND p.missing_since IS NULL),
+	c.id, c.content_hash`
+
+// albumCoverJoin joins the cover shown for each album as c
+const albumCoverJoin = `LEFT JOIN photos c ON c.id = COALESCE(a.cover_photo_id,
+	(SELECT ap.photo_id FROM album_photos ap JOIN photos p ON p.id = ap.photo_id
+		WHERE ap.album_id = a.id AND p.missing_since IS NULL
+		ORDER BY ap.position LIMIT 1))`
+
+// scanAlbum reads one row selected with albumColumns
+func scanAlbum(row rowScanner) (Album, error) {
+	var a Album
+	err := row.Scan(&a.ID, &a.Name, &a.Description, &a.CoverPhotoID, &a.CreatedAt, &a.UpdatedAt,
+		&a.PhotoCount, &a.CoverID, &a.CoverHash)
+	return a, err
+}
+
+// GetAlbums retrieves all albums ordered by name, with photo counts and covers
+func (db *DB) GetAlbums() ([]Album, error) {
+	rows, err := db.Query(`
+		SELECT ` + albumColumns + `
+		FROM albums a
+		` + albumCoverJoin + `
+		ORDER BY a.name COLLATE NOCASE, a.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var albums []Album
+	for rows.Next() {
+		a, err := scanAlbum(rows)
+		if err != nil {
+			return nil, err
+		}
+		albums = append(albums, a)
+	}
+	return albums, rows.Err()
+}
+
+// GetAlbum retrieves an album by ID with its photo count and cover.
+// Returns sql.ErrNoRows if the album does not exist.
+func (db *DB) GetAlbum(id int64) (*Album, error) {
+	a, err := scanAlbum(db.QueryRow(`
+		SELECT `+albumColumns+`
+		FROM albums a
+		`+albumCoverJoin+`
+		WHERE a.id = ?
+	`, id))
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// InsertAlbum creates an album holding photoIDs in the given order. Returns
+// ErrAlbumNameTaken if the name is in use and ErrUnknownPhoto if a photo
+// does not exist, in which case nothing is created.
+func (db *DB) InsertAlbum(name string, description sql.NullString, photoIDs []int64) (int64, error) {
+	now := time.Now().Unix()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO albums (name, description, created_at, updated_at) VALUES (?, ?, ?, ?)",
+		name, description, now, now,
+	)
+	if err != nil {
+		return 0, albumNameError(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := addAlbumPhotos(tx, id, photoIDs, -1, now); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// AlbumUpdate is a change to the fields of an album. Nil fields are kept.
+type AlbumUpdate struct {
+	Name         *string
+	Description  *sql.NullString
+	CoverPhotoID *sql.NullInt64 // NULL goes back to showing the first photo
+}
+
+// UpdateAlbum changes the fields of an album set in update, all at once or
+// not at all. Returns sql.ErrNoRows if the album does not exist,
+// ErrAlbumNameTaken if the name is in use and ErrNotInAlbum if the cover is
+// not a member.
+func (db *DB) UpdateAlbum(id int64, update AlbumUpdate) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	order, err := albumOrder(tx, id)
+	if err != nil {
+		return err
+	}
+
+	sets := []string{"updated_at = ?"}
+	args := []any{time.Now().Unix()}
+	if update.Name != nil {
+		sets = append(sets, "name = ?")
+		args = append(args, *update.Name)
+	}
+	if update.Description != nil {
+		sets = append(sets, "description = ?")
+		args = append(args, *update.Description)
+	}
+	if cover := update.CoverPhotoID; cover != nil {
+		if cover.Valid && !slices.Contains(order, cover.Int64) {
+			return ErrNotInAlbum
+		}
+		sets = append(sets, "cover_photo_id = ?")
+		args = append(args, *cover)
+	}
+
+	if _, err := tx.Exec("UPDATE albums SET "+strings.Join(sets, ", ")+" WHERE id = ?", append(args, id)...); err != nil {
+		return albumNameError(err)
+	}
+
+	return tx.Commit()
+}
+
+// DeleteAlbum deletes an album. Its photos are kept.
+// Returns sql.ErrNoRows if the album does not exist.
+func (db *DB) DeleteAlbum(id int64) error {
+	var deleted int64
+	return db.QueryRow("DELETE FROM albums WHERE id = ? RETURNING id", id).Scan(&deleted)
+}
+
+// GetAlbumPhotos retrieves the photos of an album in album order, leaving
+// out those missing from disk
+func (db *DB) GetAlbumPhotos(id int64) ([]Photo, error) {
+	rows, err := db.Query(`
+		SELECT `+photoColumns+`
+		FROM album_photos ap
+		JOIN photos ON photos.id = ap.photo_id
+		WHERE ap.album_id = ? AND photos.missing_since IS NULL
+		ORDER BY ap.position
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPhotos(rows)
+}
+
+// AddAlbumPhotos inserts photos into an album before the photo at position,
+// or at the end when position is negative or past it. Photos already in the
+// album stay where they are. Returns how many photos were added,
+// sql.ErrNoRows if the album does not exist and ErrUnknownPhoto if a photo
+// does not, in which case none is added.
+func (db *DB) AddAlbumPhotos(id int64, photoIDs []int64, position int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	added, err := addAlbumPhotos(tx, id, photoIDs, position, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	if err := touchAlbum(tx, id); err != nil {
+		return 0, err
+	}
+
+	return added, tx.Commit()
+}
+
+// RemoveAlbumPhotos takes photos out of an album, keeping the order of the
+// rest. A removed cover goes back to the first photo. Returns how many
+// photos were removed, or sql.ErrNoRows if the album does not exist.
+func (db *DB) RemoveAlbumPhotos(id int64, photoIDs []int64) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	order, err := albumOrder(tx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare("DELETE FROM album_photos WHERE album_id = ? AND photo_id = ?")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	removed := 0
+	for _, photoID := range photoIDs {
+		if i := slices.Index(order, photoID); i >= 0 {
+			if _, err := stmt.Exec(id, photoID); err != nil {
+				return 0, err
+			}
+			order = slices.Delete(order, i, i+1)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	if err := writeAlbumOrder(tx, id, order); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`
+		UPDATE albums SET cover_photo_id = NULL
+		WHERE id = ? AND cover_photo_id NOT IN (SELECT photo_id FROM album_photos WHERE album_id = ?)
+	`, id, id); err != nil {
+		return 0, err
+	}
+	if err := touchAlbum(tx, id); err != nil {
+		return 0, err
+	}
+
+	return removed, tx.Commit()
+}
+
+// ReorderAlbumPhotos moves photoIDs, in the given order, to the start of an
+// album; the other photos follow in their current order. Returns
+// sql.ErrNoRows if the album does not exist and ErrNotInAlbum if a photo is
+// not a member.
+func (db *DB) ReorderAlbumPhotos(id int64, photoIDs []int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	order, err := albumOrder(tx, id)
+	if err != nil {
+		return err
+	}
+
+	moved := make(map[int64]bool, len(photoIDs))
+	for _, photoID := range photoIDs {
+		if !slices.Contains(order, photoID) {
+			return fmt.Errorf("photo %d: %w", photoID, ErrNotInAlbum)
+		}
+		moved[photoID] = true
+	}
+
+	reordered := make([]int64, 0, len(order))
+	for _, photoID := range photoIDs {
+		if !slices.Contains(reordered, photoID) {
+			reordered = append(reordered, photoID)
+		}
+	}
+	for _, photoID := range order {
+		if !moved[photoID] {
+			reordered = append(reordered, photoID)
+		}
+	}
+
+	if err := writeAlbumOrder(tx, id, reordered); err != nil {
+		return err
+	}
+	if err := touchAlbum(tx, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// addAlbumPhotos inserts the photos not yet in an album at position and
+// renumbers the album
+func addAlbumPhotos(tx *sql.Tx, id int64, photoIDs []int64, position int, now int64) (int, error) {
+	order, err := albumOrder(tx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	var added []int64
+	for _, photoID := range photoIDs {
+		if slices.Contains(order, photoID) || slices.Contains(added, photoID) {
+			continue
+		}
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM photos WHERE id = ?)", photoID).Scan(&exists); err != nil {
+			return 0, err
+		}
+		if !exists {
+			return 0, fmt.Errorf("photo %d: %w", photoID, ErrUnknownPhoto)
+		}
+		added = append(added, photoID)
+	}
+	if len(added) == 0 {
+		return 0, nil
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO album_photos (album_id, photo_id, position, added_at) VALUES (?, ?, 0, ?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for _, photoID := range added {
+		if _, err := stmt.Exec(id, photoID, now); err != nil {
+			return 0, err
+		}
+	}
+
+	if position < 0 || position > len(order) {
+		position = len(order)
+	}
+	return len(added), writeAlbumOrder(tx, id, slices.Insert(order, position, added...))
+}
+
+// albumOrder returns the photo IDs of an album in order, or sql.ErrNoRows if
+// the album does not exist
+func albumOrder(tx *sql.Tx, id int64) ([]int64, error) {
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM albums WHERE id = ?)", id).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	rows, err := tx.Query("SELECT photo_id FROM album_photos WHERE album_id = ? ORDER BY position, added_at", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var order []int64
+	for rows.Next() {
+		var photoID int64
+		if err := rows.Scan(&photoID); err != nil {
+			return nil, err
+		}
+		order = append(order, photoID)
+	}
+	return order, rows.Err()
+}
+
+// writeAlbumOrder numbers the photos of an album from 0 in the given order
+func writeAlbumOrder(tx *sql.Tx, id int64, order []int64) error {
+	stmt, err := tx.Prepare("UPDATE album_photos SET position = ? WHERE album_id = ? AND photo_id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for position, photoID := range order {
+		if _, err := stmt.Exec(position, id, photoID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// touchAlbum records that an album changed
+func touchAlbum(tx *sql.Tx, id int64) error {
+	_, err := tx.Exec("UPDATE albums SET updated_at = ? WHERE id = ?", time.Now().Unix(), id)
+	return err
+}
+
+// albumNameError maps a unique constraint failure on album names to
+// ErrAlbumNameTaken
+func albumNameError(err error) error {
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed: albums.name") {
+		return ErrAlbumNameTaken
+	}
+	return err
+}
@@ -2,7 +2,9 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite" // Pure Go SQLite driver
@@ -12,96 +14,34 @@ type DB struct {
 	*sql.DB
 }
 
-// Open opens a connection to the SQLite database and initializes schema
+// Open opens a connection to the SQLite database and migrates its schema
+// to the latest version
 func Open(dbPath string) (*DB, error) {
-	sqlDB, err := sql.Open("sqlite", dbPath)
+	db, err := OpenUnmigrated(dbPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
 
-	db := &DB{sqlDB}
-
-	// Initialize schema
-	if err := db.initSchema(); err != nil {
-		sqlDB.Close()
-		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	if _, err := db.MigrateUp(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
 	}
 
 	return db, nil
 }
 
-func (db *DB) initSchema() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS photos (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		path TEXT NOT NULL UNIQUE,
-		filename TEXT NOT NULL,
-		imported_at INTEGER NOT NULL,
-		favorite BOOLEAN DEFAULT FALSE,
-		metadata_json TEXT,
-		thumbnail_path TEXT
-	);
-
-	CREATE TABLE IF NOT EXISTS albums (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL UNIQUE,
-		directory_path TEXT NOT NULL,
-		created_at INTEGER NOT NULL,
-		description TEXT
-	);
-
-	CREATE TABLE IF NOT EXISTS people (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		face_encodings TEXT,
-		created_at INTEGER NOT NULL
-	);
-
-	CREATE TABLE IF NOT EXISTS photo_people (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		photo_id INTEGER NOT NULL,
-		person_id INTEGER NOT NULL,
-		confidence REAL DEFAULT 1.0,
-		confirmed BOOLEAN DEFAULT FALSE,
-		created_at INTEGER NOT NULL,
-		FOREIGN KEY (photo_id) REFERENCES photos (id),
-		FOREIGN KEY (person_id) REFERENCES people (id),
-		UNIQUE (photo_id, person_id)
-	);
-
-	CREATE TABLE IF NOT EXISTS face_tags (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		photo_filename TEXT NOT NULL,
-		person_id INTEGER,
-		x REAL NOT NULL,
-		y REAL NOT NULL,
-		width REAL NOT NULL,
-		height REAL NOT NULL,
-		confidence REAL DEFAULT 1.0,
-		is_manual BOOLEAN DEFAULT TRUE,
-		created_at INTEGER NOT NULL,
-		FOREIGN KEY (person_id) REFERENCES people (id)
-	);
-
-	CREATE TABLE IF NOT EXISTS import_status (
-		id INTEGER PRIMARY KEY,
-		last_scan INTEGER NOT NULL,
-		photos_imported INTEGER DEFAULT 0,
-		last_import_path TEXT
-	);
-
-	-- Indexes for performance
-	CREATE INDEX IF NOT EXISTS idx_photos_path ON photos (path);
-	CREATE INDEX IF NOT EXISTS idx_photos_imported_at ON photos (imported_at);
-	CREATE INDEX IF NOT EXISTS idx_photos_favorite ON photos (favorite);
-	CREATE INDEX IF NOT EXISTS idx_photo_people_photo_id ON photo_people (photo_id);
-	CREATE INDEX IF NOT EXISTS idx_photo_people_person_id ON photo_people (person_id);
-	CREATE INDEX IF NOT EXISTS idx_face_tags_photo_filename ON face_tags (photo_filename);
-	CREATE INDEX IF NOT EXISTS idx_face_tags_person_id ON face_tags (person_id);
-	`
-
-	_, err := db.Exec(schema)
-	return err
+// OpenUnmigrated opens a connection to the SQLite database without applying
+// pending migrations, for tooling that manages the schema itself
+func OpenUnmigrated(dbPath string) (*DB, error) {
+	// Foreign keys are off by default in SQLite and must be enabled per
+	// connection. The busy timeout lets the filesystem watcher and HTTP
+	// handlers write concurrently without failing with SQLITE_BUSY.
+	sqlDB, err := sql.Open("sqlite", dbPath+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	return &DB{sqlDB}, nil
 }
 
 // Photo represents a photo in the database
@@ -110,24 +50,94 @@ type Photo struct {
 	Path          string
 	Filename      string
 	ImportedAt    int64
+	TakenAt       sql.NullInt64  // Unix time the photo was captured
+	TakenOffset   sql.NullInt64  // Seconds east of UTC, when the source recorded it
+	ContentHash   sql.NullString // Hex SHA-256 of the file bytes
+	FileSize      sql.NullInt64
+	PHash         sql.NullInt64   // 64-bit perceptual hash, stored as its int64 bit pattern
+	MissingSince  sql.NullInt64   // Unix time the file was found missing from disk
+	MediaType     string          // MediaPhoto or MediaVideo; empty means MediaPhoto on insert
+	Duration      sql.NullFloat64 // Video length in seconds
+	VideoCodec    sql.NullString  // e.g. "h264", "hevc"
+	ContentID     sql.NullString  // Apple content identifier shared by a Live Photo's still and movie
+	LiveVideoID   sql.NullInt64   // The movie of a Live Photo, on its still
+	RawID         sql.NullInt64   // The RAW file of a RAW+JPEG pair, on its JPEG
+	RawFilename   sql.NullString  // Joined from the RAW file's row
+	Latitude      sql.NullFloat64 // Signed decimal degrees
+	Longitude     sql.NullFloat64 // Signed decimal degrees
+	Altitude      sql.NullFloat64 // Metres, negative below sea level
+	Country       sql.NullString  // Place names, from the position
+	Region        sql.NullString
+	City          sql.NullString
+	PlaceSource   sql.NullString // Version of the gazetteer that named the place, if looked up
 	Favorite      bool
 	MetadataJSON  sql.NullString
 	ThumbnailPath sql.NullString
 }
 
+// Media types of library items
+const (
+	MediaPhoto = "photo"
+	MediaVideo = "video"
+)
+
+// mediaType returns the media type to store for p
+func (p *Photo) mediaType() string {
+	if p.MediaType == "" {
+		return MediaPhoto
+	}
+	return p.MediaType
+}
+
+// photoColumns is the column list scanned by scanPhoto. Columns are
+// qualified so the list can be used in joins.
+const photoColumns = "photos.id, photos.path, photos.filename, photos.imported_at, photos.taken_at, photos.taken_offset, " +
+	"photos.content_hash, photos.file_size, photos.phash, photos.missing_since, photos.media_type, photos.duration, " +
+	"photos.video_codec, photos.content_identifier, photos.live_video_id, photos.raw_id, " +
+	"(SELECT r.filename FROM photos r WHERE r.id = photos.raw_id), photos.latitude, photos.longitude, " +
+	"photos.altitude, photos.country, photos.region, photos.city, photos.place_source, photos.favorite, photos.metadata_json, " +
+	"photos.thumbnail_path"
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanPhoto reads one row selected with photoColumns
+func scanPhoto(row rowScanner) (Photo, error) {
+	var p Photo
+	err := row.Scan(&p.ID, &p.Path, &p.Filename, &p.ImportedAt, &p.TakenAt, &p.TakenOffset,
+		&p.ContentHash, &p.FileSize, &p.PHash, &p.MissingSince, &p.MediaType, &p.Duration, &p.VideoCodec,
+		&p.ContentID, &p.LiveVideoID, &p.RawID, &p.RawFilename,
+		&p.Latitude, &p.Longitude, &p.Altitude, &p.Country, &p.Region, &p.City, &p.PlaceSource,
+		&p.Favorite, &p.MetadataJSON, &p.ThumbnailPath)
+	return p, err
+}
+
+// ErrUnknownPerson is returned when tagging a face with a person that does
+// not exist
+var ErrUnknownPerson = errors.New("unknown person")
+
 // Person represents a person for face tagging
 type Person struct {
 	ID            int64
 	Name          string
 	FaceEncodings sql.NullString
 	CreatedAt     int64
+
+	// Computed when listing, over the photos listings show
+	PhotoCount     int
+	LastSeen       sql.NullInt64 // taken_at of the newest dated photo
+	LastSeenOffset sql.NullInt64 // Its taken_offset
 }
 
 // FaceTag represents a face tag on a photo
 type FaceTag struct {
 	ID            int64
-	PhotoFilename string
+	PhotoID       int64
+	PhotoFilename string // Joined from photos for filename-based callers
 	PersonID      sql.NullInt64
+	PersonName    sql.NullString
 	X             float64
 	Y             float64
 	Width         float64
@@ -137,19 +147,19 @@ type FaceTag struct {
 	CreatedAt     int64
 }
 
-// InsertPhoto inserts a new photo into the database
-func (db *DB) InsertPhoto(path, filename string, metadataJSON *string) (int64, error) {
+// InsertPhoto inserts a new photo into the database. ImportedAt is set to
+// the current time; ID, Favorite and ThumbnailPath are ignored.
+func (db *DB) InsertPhoto(p *Photo) (int64, error) {
 	now := time.Now().Unix()
 
-	var meta sql.NullString
-	if metadataJSON != nil {
-		meta = sql.NullString{String: *metadataJSON, Valid: true}
-	}
-
-	result, err := db.Exec(
-		"INSERT INTO photos (path, filename, imported_at, metadata_json) VALUES (?, ?, ?, ?)",
-		path, filename, now, meta,
-	)
+	result, err := db.Exec(`
+		INSERT INTO photos (path, filename, imported_at, taken_at, taken_offset, content_hash, file_size,
+			media_type, duration, video_codec, content_identifier, latitude, longitude, altitude,
+			country, region, city, place_source, metadata_json)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, p.Path, p.Filename, now, p.TakenAt, p.TakenOffset, p.ContentHash, p.FileSize,
+		p.mediaType(), p.Duration, p.VideoCodec, p.ContentID, p.Latitude, p.Longitude, p.Altitude,
+		p.Country, p.Region, p.City, p.PlaceSource, p.MetadataJSON)
 	if err != nil {
 		return 0, err
 	}
@@ -157,22 +167,203 @@ func (db *DB) InsertPhoto(path, filename string, metadataJSON *string) (int64, e
 	return result.LastInsertId()
 }
 
-// GetPhotos retrieves all photos ordered by import time
+// InsertPhotos inserts several photos in one transaction, setting the ID of
+// each. Like InsertPhoto, ImportedAt is set to the current time. Either every
+// photo is inserted or none is.
+func (db *DB) InsertPhotos(photos []*Photo) error {
+	now := time.Now().Unix()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO photos (path, filename, imported_at, taken_at, taken_offset, content_hash, file_size,
+			media_type, duration, video_codec, content_identifier, latitude, longitude, altitude,
+			country, region, city, place_source, metadata_json)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	ids := make([]int64, len(photos))
+	for i, p := range photos {
+		result, err := stmt.Exec(p.Path, p.Filename, now, p.TakenAt, p.TakenOffset, p.ContentHash, p.FileSize,
+			p.mediaType(), p.Duration, p.VideoCodec, p.ContentID, p.Latitude, p.Longitude, p.Altitude,
+			p.Country, p.Region, p.City, p.PlaceSource, p.MetadataJSON)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Path, err)
+		}
+		if ids[i], err = result.LastInsertId(); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for i, p := range photos {
+		p.ID = ids[i]
+		p.ImportedAt = now
+	}
+	return nil
+}
+
+// GetPhotos retrieves all photos ordered by capture time, newest first.
+// Photos whose capture time is not yet known sort last.
 func (db *DB) GetPhotos() ([]Photo, error) {
 	rows, err := db.Query(`
-		SELECT id, path, filename, imported_at, favorite, metadata_json, thumbnail_path
+		SELECT ` + photoColumns + `
 		FROM photos
-		ORDER BY imported_at DESC
+		ORDER BY taken_at DESC, id DESC
 	`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	return scanPhotos(rows)
+}
+
+// GetPhotosMissingTakenAt retrieves photos whose capture time has not been
+// determined yet, such as rows imported before taken_at existed
+func (db *DB) GetPhotosMissingTakenAt() ([]Photo, error) {
+	rows, err := db.Query(`
+		SELECT ` + photoColumns + `
+		FROM photos
+		WHERE taken_at IS NULL
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPhotos(rows)
+}
+
+// SetTakenAt stores the capture time of several photos in one transaction.
+// Only the TakenAt and TakenOffset fields of each photo are written.
+func (db *DB) SetTakenAt(photos []Photo) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE photos SET taken_at = ?, taken_offset = ? WHERE id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range photos {
+		if _, err := stmt.Exec(p.TakenAt, p.TakenOffset, p.ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetPhoto retrieves a photo by ID.
+// Returns sql.ErrNoRows if the photo does not exist.
+func (db *DB) GetPhoto(id int64) (*Photo, error) {
+	p, err := scanPhoto(db.QueryRow("SELECT "+photoColumns+" FROM photos WHERE id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetPhotoByFilename retrieves the photo with the given filename, for callers
+// that predate photo IDs. Filenames are not unique across folders, so the
+// lowest ID wins. Returns sql.ErrNoRows if no photo matches.
+func (db *DB) GetPhotoByFilename(filename string) (*Photo, error) {
+	p, err := scanPhoto(db.QueryRow(
+		"SELECT "+photoColumns+" FROM photos WHERE filename = ? ORDER BY id LIMIT 1",
+		filename,
+	))
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// SetFavorite sets the favorite flag on a photo.
+// Returns sql.ErrNoRows if the photo does not exist.
+func (db *DB) SetFavorite(id int64, favorite bool) error {
+	result, err := db.Exec("UPDATE photos SET favorite = ? WHERE id = ?", favorite, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ToggleFavorite flips the favorite flag on a photo and returns the new value.
+// Returns sql.ErrNoRows if the photo does not exist.
+func (db *DB) ToggleFavorite(id int64) (bool, error) {
+	var favorite bool
+	err := db.QueryRow(
+		"UPDATE photos SET favorite = NOT favorite WHERE id = ? RETURNING favorite",
+		id,
+	).Scan(&favorite)
+	return favorite, err
+}
+
+// SetFavorites sets the favorite flag on several photos in one transaction
+// and returns how many photos were updated. Unknown IDs are ignored.
+func (db *DB) SetFavorites(ids []int64, favorite bool) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE photos SET favorite = ? WHERE id = ?")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var updated int64
+	for _, id := range ids {
+		result, err := stmt.Exec(favorite, id)
+		if err != nil {
+			return 0, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		updated += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// scanPhotos reads all rows of a photos query into a slice
+func scanPhotos(rows *sql.Rows) ([]Photo, error) {
 	var photos []Photo
 	for rows.Next() {
-		var p Photo
-		if err := rows.Scan(&p.ID, &p.Path, &p.Filename, &p.ImportedAt, &p.Favorite, &p.MetadataJSON, &p.ThumbnailPath); err != nil {
+		p, err := scanPhoto(rows)
+		if err != nil {
 			return nil, err
 		}
 		photos = append(photos, p)
@@ -181,13 +372,22 @@ func (db *DB) GetPhotos() ([]Photo, error) {
 	return photos, rows.Err()
 }
 
-// GetPeople retrieves all people
-func (db *DB) GetPeople() ([]Person, error) {
+// queryPeople selects people matching cond with their photo counts and when
+// they were last seen, through photo_people
+func (db *DB) queryPeople(cond string, args ...any) ([]Person, error) {
+	conds, filterArgs := PhotoFilter{}.where()
+	tagged := "photo_people pp JOIN photos ON photos.id = pp.photo_id WHERE pp.person_id = people.id AND " + strings.Join(conds, " AND ")
+
 	rows, err := db.Query(`
-		SELECT id, name, face_encodings, created_at
+		SELECT people.id, people.name, people.face_encodings, people.created_at,
+			(SELECT COUNT(*) FROM `+tagged+`),
+			last.taken_at, last.taken_offset
 		FROM people
-		ORDER BY name
-	`)
+		LEFT JOIN photos last ON last.id = (SELECT photos.id FROM `+tagged+`
+			AND photos.taken_at IS NOT NULL ORDER BY photos.taken_at DESC, photos.id DESC LIMIT 1)
+		WHERE `+cond+`
+		ORDER BY people.name
+	`, append(append(append([]any{}, filterArgs...), filterArgs...), args...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -196,7 +396,7 @@ func (db *DB) GetPeople() ([]Person, error) {
 	var people []Person
 	for rows.Next() {
 		var p Person
-		if err := rows.Scan(&p.ID, &p.Name, &p.FaceEncodings, &p.CreatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.FaceEncodings, &p.CreatedAt, &p.PhotoCount, &p.LastSeen, &p.LastSeenOffset); err != nil {
 			return nil, err
 		}
 		people = append(people, p)
@@ -205,6 +405,24 @@ func (db *DB) GetPeople() ([]Person, error) {
 	return people, rows.Err()
 }
 
+// GetPeople retrieves all people with their photo counts
+func (db *DB) GetPeople() ([]Person, error) {
+	return db.queryPeople("1")
+}
+
+// GetPerson retrieves a person by ID with their photo count.
+// Returns sql.ErrNoRows if the person does not exist.
+func (db *DB) GetPerson(id int64) (*Person, error) {
+	people, err := db.queryPeople("people.id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(people) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &people[0], nil
+}
+
 // InsertPerson creates a new person
 func (db *DB) InsertPerson(name string) (int64, error) {
 	now := time.Now().Unix()
@@ -224,20 +442,22 @@ func (db *DB) UpdatePerson(id int64, name string) error {
 	return err
 }
 
-// DeletePerson deletes a person
+// DeletePerson deletes a person. Their face tags are kept but unassigned.
 func (db *DB) DeletePerson(id int64) error {
 	_, err := db.Exec("DELETE FROM people WHERE id = ?", id)
 	return err
 }
 
 // GetFaceTagsForPhoto retrieves face tags for a specific photo
-func (db *DB) GetFaceTagsForPhoto(photoFilename string) ([]FaceTag, error) {
+func (db *DB) GetFaceTagsForPhoto(photoID int64) ([]FaceTag, error) {
 	rows, err := db.Query(`
-		SELECT id, photo_filename, person_id, x, y, width, height, confidence, is_manual, created_at
-		FROM face_tags
-		WHERE photo_filename = ?
-		ORDER BY created_at
-	`, photoFilename)
+		SELECT ft.id, ft.photo_id, ph.filename, ft.person_id, p.name, ft.x, ft.y, ft.width, ft.height, ft.confidence, ft.is_manual, ft.created_at
+		FROM face_tags ft
+		JOIN photos ph ON ph.id = ft.photo_id
+		LEFT JOIN people p ON p.id = ft.person_id
+		WHERE ft.photo_id = ?
+		ORDER BY ft.created_at
+	`, photoID)
 	if err != nil {
 		return nil, err
 	}
@@ -246,7 +466,7 @@ func (db *DB) GetFaceTagsForPhoto(photoFilename string) ([]FaceTag, error) {
 	var tags []FaceTag
 	for rows.Next() {
 		var t FaceTag
-		if err := rows.Scan(&t.ID, &t.PhotoFilename, &t.PersonID, &t.X, &t.Y, &t.Width, &t.Height, &t.Confidence, &t.IsManual, &t.CreatedAt); err != nil {
+		if err := rows.Scan(&t.ID, &t.PhotoID, &t.PhotoFilename, &t.PersonID, &t.PersonName, &t.X, &t.Y, &t.Width, &t.Height, &t.Confidence, &t.IsManual, &t.CreatedAt); err != nil {
 			return nil, err
 		}
 		tags = append(tags, t)
@@ -255,8 +475,26 @@ func (db *DB) GetFaceTagsForPhoto(photoFilename string) ([]FaceTag, error) {
 	return tags, rows.Err()
 }
 
-// InsertFaceTag creates a new face tag
-func (db *DB) InsertFaceTag(photoFilename string, personID *int64, x, y, width, height, confidence float64, isManual bool) (int64, error) {
+// GetFaceTag retrieves a single face tag by ID.
+// Returns sql.ErrNoRows if the tag does not exist.
+func (db *DB) GetFaceTag(id int64) (*FaceTag, error) {
+	var t FaceTag
+	err := db.QueryRow(`
+		SELECT ft.id, ft.photo_id, ph.filename, ft.person_id, p.name, ft.x, ft.y, ft.width, ft.height, ft.confidence, ft.is_manual, ft.created_at
+		FROM face_tags ft
+		JOIN photos ph ON ph.id = ft.photo_id
+		LEFT JOIN people p ON p.id = ft.person_id
+		WHERE ft.id = ?
+	`, id).Scan(&t.ID, &t.PhotoID, &t.PhotoFilename, &t.PersonID, &t.PersonName, &t.X, &t.Y, &t.Width, &t.Height, &t.Confidence, &t.IsManual, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// InsertFaceTag creates a new face tag. Returns ErrUnknownPerson if the
+// person does not exist.
+func (db *DB) InsertFaceTag(photoID int64, personID *int64, x, y, width, height, confidence float64, isManual bool) (int64, error) {
 	now := time.Now().Unix()
 
 	var pid sql.NullInt64
@@ -264,34 +502,127 @@ func (db *DB) InsertFaceTag(photoFilename string, personID *int64, x, y, width,
 		pid = sql.NullInt64{Int64: *personID, Valid: true}
 	}
 
-	result, err := db.Exec(`
-		INSERT INTO face_tags (photo_filename, person_id, x, y, width, height, confidence, is_manual, created_at)
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := checkPerson(tx, pid); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO face_tags (photo_id, person_id, x, y, width, height, confidence, is_manual, created_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, photoFilename, pid, x, y, width, height, confidence, isManual, now)
+	`, photoID, pid, x, y, width, height, confidence, isManual, now)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
 	if err != nil {
 		return 0, err
 	}
 
-	return result.LastInsertId()
+	if err := syncPhotoPeople(tx, photoID); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
 }
 
-// UpdateFaceTag updates a face tag
+// UpdateFaceTag updates a face tag. Returns ErrUnknownPerson if the person
+// does not exist.
 func (db *DB) UpdateFaceTag(id int64, personID *int64, x, y, width, height, confidence float64) error {
 	var pid sql.NullInt64
 	if personID != nil {
 		pid = sql.NullInt64{Int64: *personID, Valid: true}
 	}
 
-	_, err := db.Exec(`
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkPerson(tx, pid); err != nil {
+		return err
+	}
+
+	var photoID int64
+	err = tx.QueryRow(`
 		UPDATE face_tags
 		SET person_id = ?, x = ?, y = ?, width = ?, height = ?, confidence = ?
 		WHERE id = ?
-	`, pid, x, y, width, height, confidence, id)
-	return err
+		RETURNING photo_id
+	`, pid, x, y, width, height, confidence, id).Scan(&photoID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := syncPhotoPeople(tx, photoID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // DeleteFaceTag deletes a face tag
 func (db *DB) DeleteFaceTag(id int64) error {
-	_, err := db.Exec("DELETE FROM face_tags WHERE id = ?", id)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var photoID int64
+	err = tx.QueryRow("DELETE FROM face_tags WHERE id = ? RETURNING photo_id", id).Scan(&photoID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := syncPhotoPeople(tx, photoID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// checkPerson returns ErrUnknownPerson if a face tag is assigned to a person
+// that does not exist, before the foreign key fails with a constraint error
+func checkPerson(tx *sql.Tx, personID sql.NullInt64) error {
+	if !personID.Valid {
+		return nil
+	}
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM people WHERE id = ?)", personID.Int64).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("person %d: %w", personID.Int64, ErrUnknownPerson)
+	}
+	return nil
+}
+
+// syncPhotoPeople rebuilds the photo_people rows of a photo from its face
+// tags: one per person tagged, with the confidence of their best tag,
+// confirmed by any manual tag and dated by the first
+func syncPhotoPeople(tx *sql.Tx, photoID int64) error {
+	if _, err := tx.Exec("DELETE FROM photo_people WHERE photo_id = ?", photoID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		INSERT INTO photo_people (photo_id, person_id, confidence, confirmed, created_at)
+		SELECT photo_id, person_id, MAX(confidence), MAX(is_manual), MIN(created_at)
+		FROM face_tags
+		WHERE photo_id = ? AND person_id IS NOT NULL
+		GROUP BY person_id
+	`, photoID)
 	return err
 }
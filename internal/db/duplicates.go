@@ -0,0 +1,105 @@
+package db
+
+// DuplicateGroup is a set of photos whose files have identical content
+type DuplicateGroup struct {
+	ContentHash string
+	FileSize    int64
+	Photos      []Photo // Oldest import first
+}
+
+// GetPhotosMissingContentHash retrieves photos that have not been hashed yet,
+// such as rows imported before content hashes were tracked
+func (db *DB) GetPhotosMissingContentHash() ([]Photo, error) {
+	rows, err := db.Query(`
+		SELECT ` + photoColumns + `
+		FROM photos
+		WHERE content_hash IS NULL
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPhotos(rows)
+}
+
+// SetContentHashes stores the content hash and file size of several photos
+// in one transaction. Only the ContentHash and FileSize fields are written.
+func (db *DB) SetContentHashes(photos []Photo) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE photos SET content_hash = ?, file_size = ? WHERE id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range photos {
+		if _, err := stmt.Exec(p.ContentHash, p.FileSize, p.ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetPhotosByContentHash retrieves every photo with the given content hash
+func (db *DB) GetPhotosByContentHash(hash string) ([]Photo, error) {
+	rows, err := db.Query(`
+		SELECT `+photoColumns+`
+		FROM photos
+		WHERE content_hash = ?
+		ORDER BY id
+	`, hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPhotos(rows)
+}
+
+// GetDuplicateGroups retrieves all sets of two or more photos with identical
+// content, largest files first. Photos missing from disk are left out.
+func (db *DB) GetDuplicateGroups() ([]DuplicateGroup, error) {
+	rows, err := db.Query(`
+		SELECT ` + photoColumns + `
+		FROM photos
+		WHERE missing_since IS NULL AND content_hash IN (
+			SELECT content_hash
+			FROM photos
+			WHERE content_hash IS NOT NULL AND missing_since IS NULL
+			GROUP BY content_hash
+			HAVING COUNT(*) > 1
+		)
+		ORDER BY file_size DESC, content_hash, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos, err := scanPhotos(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []DuplicateGroup
+	for _, p := range photos {
+		if n := len(groups); n == 0 || groups[n-1].ContentHash != p.ContentHash.String {
+			groups = append(groups, DuplicateGroup{
+				ContentHash: p.ContentHash.String,
+				FileSize:    p.FileSize.Int64,
+			})
+		}
+		last := &groups[len(groups)-1]
+		last.Photos = append(last.Photos, p)
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,205 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+)
+
+// Folder is a directory of the photos directory
+type Folder struct {
+	ID       int64
+	Path     string
+	ParentID sql.NullInt64 // NULL for the photos directory itself
+	Name     string
+
+	// Computed when listing, over the folder and its subfolders
+	PhotoCount int
+	CoverID    sql.NullInt64  // The most recently captured photo
+	CoverHash  sql.NullString // Its content hash, to version the thumbnail URL
+}
+
+// queryFolders selects folders matching cond with their photo counts and
+// covers. Counts and covers follow the default listing filter and take in
+// the photos below each folder through the path range its prefix spans:
+// '0' sorts right after '/'.
+func (db *DB) queryFolders(cond, order string, args ...any) ([]Folder, error) {
+	conds, filterArgs := PhotoFilter{}.where()
+	below := "photos.path > folders.path || '/' AND photos.path < folders.path || '0' AND " + strings.Join(conds, " AND ")
+
+	rows, err := db.Query(`
+		SELECT f.id, f.path, f.parent_id, f.name, f.photo_count, f.cover_id, c.content_hash
+		FROM (
+			SELECT folders.*,
+				(SELECT COUNT(*) FROM photos WHERE `+below+`) AS photo_count,
+				(SELECT photos.id FROM photos WHERE `+below+`
+					ORDER BY photos.taken_at DESC, photos.id DESC LIMIT 1) AS cover_id
+			FROM folders
+			WHERE `+cond+`
+		) f
+		LEFT JOIN photos c ON c.id = f.cover_id
+		ORDER BY `+order,
+		append(append(append([]any{}, filterArgs...), filterArgs...), args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var folders []Folder
+	for rows.Next() {
+		var f Folder
+		if err := rows.Scan(&f.ID, &f.Path, &f.ParentID, &f.Name, &f.PhotoCount, &f.CoverID, &f.CoverHash); err != nil {
+			return nil, err
+		}
+		folders = append(folders, f)
+	}
+	return folders, rows.Err()
+}
+
+// GetFolder retrieves the folder at path with its photo count and cover.
+// Returns sql.ErrNoRows if there is none.
+func (db *DB) GetFolder(path string) (*Folder, error) {
+	folders, err := db.queryFolders("folders.path = ?", "f.id", path)
+	if err != nil {
+		return nil, err
+	}
+	if len(folders) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &folders[0], nil
+}
+
+// GetSubfolders retrieves the folders directly inside a folder, by name,
+// with their photo counts and covers
+func (db *DB) GetSubfolders(id int64) ([]Folder, error) {
+	return db.queryFolders("folders.parent_id = ?", "f.name COLLATE NOCASE, f.id", id)
+}
+
+// SyncFolders mirrors the directories of root, the photos directory, in the
+// folders table: every photo below root is linked to the folder of its
+// directory, creating folders as needed, and folders left without photos
+// below them are deleted. Photos missing from disk keep their folder. Returns
+// how many photos changed folder.
+func (db *DB) SyncFolders(root string) (int, error) {
+	root = filepath.Clean(root)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Photos outside root, e.g. after the photos directory moved
+	if _, err := tx.Exec(`
+		UPDATE photos SET folder_id = NULL
+		WHERE folder_id IS NOT NULL AND NOT (path > ? AND path < ?)
+	`, root+"/", root+"0"); err != nil {
+		return 0, err
+	}
+
+	// Photos with no folder, or one that is not their directory
+	rows, err := tx.Query(`
+		SELECT photos.id, photos.path
+		FROM photos
+		LEFT JOIN folders f ON f.id = photos.folder_id
+		WHERE photos.path > ? AND photos.path < ?
+			AND (f.id IS NULL OR NOT (photos.path > f.path || '/' AND photos.path < f.path || '0')
+				OR instr(substr(photos.path, length(f.path) + 2), '/') > 0)
+	`, root+"/", root+"0")
+	if err != nil {
+		return 0, err
+	}
+	type relink struct {
+		id   int64
+		path string
+	}
+	var relinks []relink
+	for rows.Next() {
+		var r relink
+		if err := rows.Scan(&r.id, &r.path); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		relinks = append(relinks, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	folders := make(map[string]int64)
+	if _, err := ensureFolder(tx, root, root, folders); err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare("UPDATE photos SET folder_id = ? WHERE id = ?")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for _, r := range relinks {
+		folderID, err := ensureFolder(tx, root, filepath.Dir(r.path), folders)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := stmt.Exec(folderID, r.id); err != nil {
+			return 0, err
+		}
+	}
+
+	// Deleting empty leaves may empty their parents
+	for {
+		result, err := tx.Exec(`
+			DELETE FROM folders
+			WHERE path <> ?
+				AND NOT EXISTS (SELECT 1 FROM photos WHERE photos.folder_id = folders.id)
+				AND NOT EXISTS (SELECT 1 FROM folders c WHERE c.parent_id = folders.id)
+		`, root)
+		if err != nil {
+			return 0, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	return len(relinks), tx.Commit()
+}
+
+// ensureFolder returns the ID of the folder at dir, creating it and its
+// missing parents up to root. known caches folder IDs by path.
+func ensureFolder(tx *sql.Tx, root, dir string, known map[string]int64) (int64, error) {
+	if id, ok := known[dir]; ok {
+		return id, nil
+	}
+
+	var parentID sql.NullInt64
+	if dir != root {
+		id, err := ensureFolder(tx, root, filepath.Dir(dir), known)
+		if err != nil {
+			return 0, err
+		}
+		parentID = sql.NullInt64{Int64: id, Valid: true}
+	}
+
+	// The parent is refreshed too: a root folder left by another photos
+	// directory becomes a subfolder when the new one contains it
+	var id int64
+	err := tx.QueryRow(`
+		INSERT INTO folders (path, parent_id, name) VALUES (?, ?, ?)
+		ON CONFLICT (path) DO UPDATE SET parent_id = excluded.parent_id
+		RETURNING id
+	`, dir, parentID, filepath.Base(dir)).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	known[dir] = id
+	return id, nil
+}
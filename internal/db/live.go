@@ -0,0 +1,64 @@
+package db
+
+// GetUnpairedVideos retrieves videos on disk that are not yet linked as the
+// movie of a Live Photo
+func (db *DB) GetUnpairedVideos() ([]Photo, error) {
+	rows, err := db.Query(`
+		SELECT `+photoColumns+`
+		FROM photos
+		WHERE media_type = ? AND missing_since IS NULL
+			AND NOT EXISTS (SELECT 1 FROM photos s WHERE s.live_video_id = photos.id)
+		ORDER BY id
+	`, MediaVideo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPhotos(rows)
+}
+
+// GetLivePhotoCandidates retrieves unpaired stills that may belong with a
+// movie: those sharing its content identifier, and those whose path is stem
+// plus an extension, e.g. "/photos/IMG_1234.HEIC" for stem "/photos/IMG_1234"
+func (db *DB) GetLivePhotoCandidates(contentID, stem string) ([]Photo, error) {
+	// '/' sorts right after '.', so the range covers stem.* without LIKE
+	// escaping
+	rows, err := db.Query(`
+		SELECT `+photoColumns+`
+		FROM photos
+		WHERE media_type = ? AND live_video_id IS NULL AND missing_since IS NULL
+			AND (content_identifier = ? OR (path > ? AND path < ?))
+		ORDER BY id
+	`, MediaPhoto, contentID, stem+".", stem+"/")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPhotos(rows)
+}
+
+// SetLiveVideos links stills to their Live Photo movies in one transaction.
+// Only the LiveVideoID field of each photo is written.
+func (db *DB) SetLiveVideos(photos []Photo) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE photos SET live_video_id = ? WHERE id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range photos {
+		if _, err := stmt.Exec(p.LiveVideoID, p.ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,195 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer
+// binary than the one trying to open it
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+// Migration is a single ordered schema change. Either the SQL or the Go
+// form of each direction is used; the Go form wins when both are set.
+type Migration struct {
+	Version int
+	Name    string
+	UpSQL   string
+	DownSQL string
+	Up      func(tx *sql.Tx) error
+	Down    func(tx *sql.Tx) error
+}
+
+// MigrationStatus describes whether a known migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt int64
+}
+
+// LatestSchemaVersion returns the schema version this binary migrates to
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+func (db *DB) ensureVersionTable() error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at INTEGER NOT NULL
+		)
+	`)
+	return err
+}
+
+// SchemaVersion returns the highest applied migration version, or 0 for a
+// database that has never been migrated
+func (db *DB) SchemaVersion() (int, error) {
+	if err := db.ensureVersionTable(); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return version, err
+}
+
+// checkSchemaVersion refuses to touch a database newer than this binary
+func (db *DB) checkSchemaVersion() (int, error) {
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return 0, err
+	}
+	if latest := LatestSchemaVersion(); current > latest {
+		return current, fmt.Errorf("%w: database is at version %d, binary supports up to %d", ErrSchemaTooNew, current, latest)
+	}
+	return current, nil
+}
+
+// MigrationStatus lists every known migration and whether it has been applied
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	if err := db.ensureVersionTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]int64)
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		status[i] = MigrationStatus{
+			Version:   m.Version,
+			Name:      m.Name,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		}
+	}
+
+	return status, nil
+}
+
+// MigrateUp applies all pending migrations in order and returns how many ran
+func (db *DB) MigrateUp() (int, error) {
+	current, err := db.checkSchemaVersion()
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if err := db.runMigration(m, true); err != nil {
+			return applied, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		applied++
+	}
+
+	return applied, nil
+}
+
+// MigrateDown reverts the given number of most recently applied migrations
+// and returns how many were reverted
+func (db *DB) MigrateDown(steps int) (int, error) {
+	current, err := db.checkSchemaVersion()
+	if err != nil {
+		return 0, err
+	}
+
+	reverted := 0
+	for i := len(migrations) - 1; i >= 0 && reverted < steps; i-- {
+		m := migrations[i]
+		if m.Version > current {
+			continue
+		}
+		if err := db.runMigration(m, false); err != nil {
+			return reverted, fmt.Errorf("reverting migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		reverted++
+	}
+
+	return reverted, nil
+}
+
+// runMigration applies or reverts a single migration inside a transaction,
+// recording the change in schema_version
+func (db *DB) runMigration(m Migration, up bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	direction, step, query := "down", m.Down, m.DownSQL
+	if up {
+		direction, step, query = "up", m.Up, m.UpSQL
+	}
+
+	switch {
+	case step != nil:
+		err = step(tx)
+	case query != "":
+		_, err = tx.Exec(query)
+	default:
+		err = fmt.Errorf("migration has no %s step", direction)
+	}
+	if err != nil {
+		return err
+	}
+
+	if up {
+		_, err = tx.Exec(
+			"INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)",
+			m.Version, m.Name, time.Now().Unix(),
+		)
+	} else {
+		_, err = tx.Exec("DELETE FROM schema_version WHERE version = ?", m.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
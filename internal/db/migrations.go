@@ -0,0 +1,476 @@
+package db
+
+// migrations is the ordered list of schema changes. Append new migrations
+// with the next version number; never edit one that has shipped.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		// IF NOT EXISTS lets databases created before schema_version existed
+		// adopt this migration without losing data
+		UpSQL: `
+		CREATE TABLE IF NOT EXISTS photos (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			path TEXT NOT NULL UNIQUE,
+			filename TEXT NOT NULL,
+			imported_at INTEGER NOT NULL,
+			favorite BOOLEAN DEFAULT FALSE,
+			metadata_json TEXT,
+			thumbnail_path TEXT
+		);
+
+		CREATE TABLE IF NOT EXISTS albums (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			directory_path TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			description TEXT
+		);
+
+		CREATE TABLE IF NOT EXISTS people (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			face_encodings TEXT,
+			created_at INTEGER NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS photo_people (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			photo_id INTEGER NOT NULL,
+			person_id INTEGER NOT NULL,
+			confidence REAL DEFAULT 1.0,
+			confirmed BOOLEAN DEFAULT FALSE,
+			created_at INTEGER NOT NULL,
+			FOREIGN KEY (photo_id) REFERENCES photos (id),
+			FOREIGN KEY (person_id) REFERENCES people (id),
+			UNIQUE (photo_id, person_id)
+		);
+
+		CREATE TABLE IF NOT EXISTS face_tags (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			photo_filename TEXT NOT NULL,
+			person_id INTEGER,
+			x REAL NOT NULL,
+			y REAL NOT NULL,
+			width REAL NOT NULL,
+			height REAL NOT NULL,
+			confidence REAL DEFAULT 1.0,
+			is_manual BOOLEAN DEFAULT TRUE,
+			created_at INTEGER NOT NULL,
+			FOREIGN KEY (person_id) REFERENCES people (id)
+		);
+
+		CREATE TABLE IF NOT EXISTS import_status (
+			id INTEGER PRIMARY KEY,
+			last_scan INTEGER NOT NULL,
+			photos_imported INTEGER DEFAULT 0,
+			last_import_path TEXT
+		);
+
+		-- Indexes for performance
+		CREATE INDEX IF NOT EXISTS idx_photos_path ON photos (path);
+		CREATE INDEX IF NOT EXISTS idx_photos_imported_at ON photos (imported_at);
+		CREATE INDEX IF NOT EXISTS idx_photos_favorite ON photos (favorite);
+		CREATE INDEX IF NOT EXISTS idx_photo_people_photo_id ON photo_people (photo_id);
+		CREATE INDEX IF NOT EXISTS idx_photo_people_person_id ON photo_people (person_id);
+		CREATE INDEX IF NOT EXISTS idx_face_tags_photo_filename ON face_tags (photo_filename);
+		CREATE INDEX IF NOT EXISTS idx_face_tags_person_id ON face_tags (person_id);
+		`,
+		DownSQL: `
+		DROP TABLE IF EXISTS face_tags;
+		DROP TABLE IF EXISTS photo_people;
+		DROP TABLE IF EXISTS people;
+		DROP TABLE IF EXISTS albums;
+		DROP TABLE IF EXISTS import_status;
+		DROP TABLE IF EXISTS photos;
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "key face tags by photo id",
+		// Tags are matched to the lowest photo ID with their filename, which
+		// is what the old filename join returned. Tags whose photo no longer
+		// exists were unreachable and are dropped. Foreign keys were not
+		// enforced before, so tags of deleted people are left unassigned.
+		UpSQL: `
+		CREATE TABLE face_tags_new (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			photo_id INTEGER NOT NULL,
+			person_id INTEGER,
+			x REAL NOT NULL,
+			y REAL NOT NULL,
+			width REAL NOT NULL,
+			height REAL NOT NULL,
+			confidence REAL DEFAULT 1.0,
+			is_manual BOOLEAN DEFAULT TRUE,
+			created_at INTEGER NOT NULL,
+			FOREIGN KEY (photo_id) REFERENCES photos (id) ON DELETE CASCADE,
+			FOREIGN KEY (person_id) REFERENCES people (id) ON DELETE SET NULL
+		);
+
+		INSERT INTO face_tags_new (id, photo_id, person_id, x, y, width, height, confidence, is_manual, created_at)
+		SELECT ft.id, p.id, CASE WHEN ft.person_id IN (SELECT id FROM people) THEN ft.person_id END, ft.x, ft.y, ft.width, ft.height, ft.confidence, ft.is_manual, ft.created_at
+		FROM face_tags ft
+		JOIN (SELECT filename, MIN(id) AS id FROM photos GROUP BY filename) p ON p.filename = ft.photo_filename;
+
+		DROP TABLE face_tags;
+		ALTER TABLE face_tags_new RENAME TO face_tags;
+
+		CREATE INDEX idx_face_tags_photo_id ON face_tags (photo_id);
+		CREATE INDEX idx_face_tags_person_id ON face_tags (person_id);
+		`,
+		DownSQL: `
+		CREATE TABLE face_tags_old (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			photo_filename TEXT NOT NULL,
+			person_id INTEGER,
+			x REAL NOT NULL,
+			y REAL NOT NULL,
+			width REAL NOT NULL,
+			height REAL NOT NULL,
+			confidence REAL DEFAULT 1.0,
+			is_manual BOOLEAN DEFAULT TRUE,
+			created_at INTEGER NOT NULL,
+			FOREIGN KEY (person_id) REFERENCES people (id)
+		);
+
+		INSERT INTO face_tags_old (id, photo_filename, person_id, x, y, width, height, confidence, is_manual, created_at)
+		SELECT ft.id, p.filename, ft.person_id, ft.x, ft.y, ft.width, ft.height, ft.confidence, ft.is_manual, ft.created_at
+		FROM face_tags ft
+		JOIN photos p ON p.id = ft.photo_id;
+
+		DROP TABLE face_tags;
+		ALTER TABLE face_tags_old RENAME TO face_tags;
+
+		CREATE INDEX idx_face_tags_photo_filename ON face_tags (photo_filename);
+		CREATE INDEX idx_face_tags_person_id ON face_tags (person_id);
+		`,
+	},
+	{
+		Version: 3,
+		Name:    "add photo capture time",
+		// Existing rows are backfilled by the importer, which can read EXIF
+		// metadata and file modification times
+		UpSQL: `
+		ALTER TABLE photos ADD COLUMN taken_at INTEGER;
+		ALTER TABLE photos ADD COLUMN taken_offset INTEGER;
+		CREATE INDEX idx_photos_taken_at ON photos (taken_at);
+		`,
+		DownSQL: `
+		DROP INDEX idx_photos_taken_at;
+		ALTER TABLE photos DROP COLUMN taken_offset;
+		ALTER TABLE photos DROP COLUMN taken_at;
+		`,
+	},
+	{
+		Version: 4,
+		Name:    "index photo camera model",
+		UpSQL: `
+		CREATE INDEX idx_photos_camera_model ON photos (json_extract(metadata_json, '$.Model'));
+		`,
+		DownSQL: `
+		DROP INDEX idx_photos_camera_model;
+		`,
+	},
+	{
+		Version: 5,
+		Name:    "add photo content hash",
+		// Existing rows are hashed by the importer on its next scan
+		UpSQL: `
+		ALTER TABLE photos ADD COLUMN content_hash TEXT;
+		ALTER TABLE photos ADD COLUMN file_size INTEGER;
+		CREATE INDEX idx_photos_content_hash ON photos (content_hash);
+		`,
+		DownSQL: `
+		DROP INDEX idx_photos_content_hash;
+		ALTER TABLE photos DROP COLUMN file_size;
+		ALTER TABLE photos DROP COLUMN content_hash;
+		`,
+	},
+	{
+		Version: 6,
+		Name:    "add photo perceptual hash",
+		// Existing rows are hashed from their thumbnails on the next scan
+		UpSQL: `
+		ALTER TABLE photos ADD COLUMN phash INTEGER;
+		`,
+		DownSQL: `
+		ALTER TABLE photos DROP COLUMN phash;
+		`,
+	},
+	{
+		Version: 7,
+		Name:    "track missing photos",
+		// Set when a photo's file disappears from disk; cleared when it
+		// reappears or is found under a new path
+		UpSQL: `
+		ALTER TABLE photos ADD COLUMN missing_since INTEGER;
+		CREATE INDEX idx_photos_missing_since ON photos (missing_since);
+		`,
+		DownSQL: `
+		DROP INDEX idx_photos_missing_since;
+		ALTER TABLE photos DROP COLUMN missing_since;
+		`,
+	},
+	{
+		Version: 8,
+		Name:    "add video metadata",
+		// Only images were imported before, so existing rows are photos
+		UpSQL: `
+		ALTER TABLE photos ADD COLUMN media_type TEXT NOT NULL DEFAULT 'photo';
+		ALTER TABLE photos ADD COLUMN duration REAL;
+		ALTER TABLE photos ADD COLUMN video_codec TEXT;
+		CREATE INDEX idx_photos_media_type ON photos (media_type);
+		`,
+		DownSQL: `
+		DROP INDEX idx_photos_media_type;
+		ALTER TABLE photos DROP COLUMN video_codec;
+		ALTER TABLE photos DROP COLUMN duration;
+		ALTER TABLE photos DROP COLUMN media_type;
+		`,
+	},
+	{
+		Version: 9,
+		Name:    "pair live photos",
+		// The still of a Live Photo links to its movie, which is hidden from
+		// listings. Existing rows pair by filename and capture time.
+		UpSQL: `
+		ALTER TABLE photos ADD COLUMN content_identifier TEXT;
+		ALTER TABLE photos ADD COLUMN live_video_id INTEGER REFERENCES photos (id) ON DELETE SET NULL;
+		CREATE INDEX idx_photos_content_identifier ON photos (content_identifier);
+		CREATE INDEX idx_photos_live_video_id ON photos (live_video_id);
+		`,
+		DownSQL: `
+		DROP INDEX idx_photos_live_video_id;
+		DROP INDEX idx_photos_content_identifier;
+		ALTER TABLE photos DROP COLUMN live_video_id;
+		ALTER TABLE photos DROP COLUMN content_identifier;
+		`,
+	},
+	{
+		Version: 10,
+		Name:    "group raw and jpeg pairs",
+		// The JPEG of a RAW+JPEG pair links to its RAW file, which is hidden
+		// from listings
+		UpSQL: `
+		ALTER TABLE photos ADD COLUMN raw_id INTEGER REFERENCES photos (id) ON DELETE SET NULL;
+		CREATE INDEX idx_photos_raw_id ON photos (raw_id);
+		`,
+		DownSQL: `
+		DROP INDEX idx_photos_raw_id;
+		ALTER TABLE photos DROP COLUMN raw_id;
+		`,
+	},
+	{
+		Version: 11,
+		Name:    "add photo location",
+		// Positions already in the stored EXIF are copied over; photos whose
+		// EXIF was read before GPS was are re-read by the importer
+		UpSQL: `
+		ALTER TABLE photos ADD COLUMN latitude REAL;
+		ALTER TABLE photos ADD COLUMN longitude REAL;
+		ALTER TABLE photos ADD COLUMN altitude REAL;
+		UPDATE photos
+		SET latitude = json_extract(metadata_json, '$.GPSLatitude'),
+			longitude = json_extract(metadata_json, '$.GPSLongitude'),
+			altitude = json_extract(metadata_json, '$.GPSAltitude')
+		WHERE json_extract(metadata_json, '$.GPSLatitude') IS NOT NULL
+			AND json_extract(metadata_json, '$.GPSLongitude') IS NOT NULL;
+		CREATE INDEX idx_photos_location ON photos (latitude, longitude);
+		`,
+		DownSQL: `
+		DROP INDEX idx_photos_location;
+		ALTER TABLE photos DROP COLUMN altitude;
+		ALTER TABLE photos DROP COLUMN longitude;
+		ALTER TABLE photos DROP COLUMN latitude;
+		`,
+	},
+	{
+		Version: 12,
+		Name:    "add photo place",
+		// Names of the place a photo was taken, from the offline geocoder.
+		// Located photos are named by the importer.
+		UpSQL: `
+		ALTER TABLE photos ADD COLUMN country TEXT;
+		ALTER TABLE photos ADD COLUMN region TEXT;
+		ALTER TABLE photos ADD COLUMN city TEXT;
+		CREATE INDEX idx_photos_place ON photos (country, region, city);
+		`,
+		DownSQL: `
+		DROP INDEX idx_photos_place;
+		ALTER TABLE photos DROP COLUMN city;
+		ALTER TABLE photos DROP COLUMN region;
+		ALTER TABLE photos DROP COLUMN country;
+		`,
+	},
+	{
+		Version: 13,
+		Name:    "add album membership",
+		// Albums list their photos in a chosen order instead of covering a
+		// directory. Photos below the directory of an existing album become
+		// its members, oldest first.
+		UpSQL: `
+		CREATE TABLE albums_new (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			description TEXT,
+			cover_photo_id INTEGER REFERENCES photos (id) ON DELETE SET NULL,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL
+		);
+		INSERT INTO albums_new (id, name, description, created_at, updated_at)
+		SELECT id, name, description, created_at, created_at FROM albums;
+
+		CREATE TABLE album_photos (
+			album_id INTEGER NOT NULL REFERENCES albums_new (id) ON DELETE CASCADE,
+			photo_id INTEGER NOT NULL REFERENCES photos (id) ON DELETE CASCADE,
+			position INTEGER NOT NULL,
+			added_at INTEGER NOT NULL,
+			PRIMARY KEY (album_id, photo_id)
+		);
+		INSERT INTO album_photos (album_id, photo_id, position, added_at)
+		SELECT a.id, p.id,
+			ROW_NUMBER() OVER (PARTITION BY a.id ORDER BY p.taken_at, p.id) - 1,
+			a.created_at
+		FROM albums a
+		JOIN photos p ON p.path LIKE a.directory_path || '/%'
+		WHERE a.directory_path <> '';
+
+		-- Renaming albums_new repoints album_photos at it
+		DROP TABLE albums;
+		ALTER TABLE albums_new RENAME TO albums;
+		CREATE INDEX idx_album_photos_position ON album_photos (album_id, position);
+		CREATE INDEX idx_album_photos_photo_id ON album_photos (photo_id);
+		`,
+		DownSQL: `
+		CREATE TABLE albums_old (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			directory_path TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			description TEXT
+		);
+		INSERT INTO albums_old (id, name, directory_path, created_at, description)
+		SELECT id, name, '', created_at, description FROM albums;
+		DROP TABLE album_photos;
+		DROP TABLE albums;
+		ALTER TABLE albums_old RENAME TO albums;
+		`,
+	},
+	{
+		Version: 14,
+		Name:    "add folders",
+		// The directories of the photos directory, each photo linked to the
+		// one it is in. The importer fills both in.
+		UpSQL: `
+		CREATE TABLE folders (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			path TEXT NOT NULL UNIQUE,
+			parent_id INTEGER REFERENCES folders (id) ON DELETE CASCADE,
+			name TEXT NOT NULL
+		);
+		CREATE INDEX idx_folders_parent_id ON folders (parent_id);
+		ALTER TABLE photos ADD COLUMN folder_id INTEGER REFERENCES folders (id) ON DELETE SET NULL;
+		CREATE INDEX idx_photos_folder_id ON photos (folder_id);
+		`,
+		DownSQL: `
+		DROP INDEX idx_photos_folder_id;
+		ALTER TABLE photos DROP COLUMN folder_id;
+		DROP TABLE folders;
+		`,
+	},
+	{
+		Version: 15,
+		Name:    "add smart albums",
+		// Albums whose photos are those matching a rule, kept in its JSON
+		// form and compiled when listed (see Rule)
+		UpSQL: `
+		CREATE TABLE smart_albums (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			rule TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL
+		);
+		`,
+		DownSQL: `
+		DROP TABLE smart_albums;
+		`,
+	},
+	{
+		Version: 16,
+		Name:    "derive photo people from face tags",
+		// One row for each person tagged in a photo, kept in step with
+		// face_tags by the face tag queries: confidence is that of the best
+		// tag and confirmed is set by any manual one. Rebuilt from the tags,
+		// as nothing wrote it before, and cascading like them.
+		UpSQL: `
+		CREATE TABLE photo_people_new (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			photo_id INTEGER NOT NULL REFERENCES photos (id) ON DELETE CASCADE,
+			person_id INTEGER NOT NULL REFERENCES people (id) ON DELETE CASCADE,
+			confidence REAL DEFAULT 1.0,
+			confirmed BOOLEAN DEFAULT FALSE,
+			created_at INTEGER NOT NULL,
+			UNIQUE (photo_id, person_id)
+		);
+		INSERT INTO photo_people_new (photo_id, person_id, confidence, confirmed, created_at)
+		SELECT photo_id, person_id, MAX(confidence), MAX(is_manual), MIN(created_at)
+		FROM face_tags
+		WHERE person_id IS NOT NULL
+		GROUP BY photo_id, person_id;
+
+		DROP TABLE photo_people;
+		ALTER TABLE photo_people_new RENAME TO photo_people;
+		CREATE INDEX idx_photo_people_photo_id ON photo_people (photo_id);
+		CREATE INDEX idx_photo_people_person_id ON photo_people (person_id);
+		`,
+		DownSQL: `
+		CREATE TABLE photo_people_old (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			photo_id INTEGER NOT NULL,
+			person_id INTEGER NOT NULL,
+			confidence REAL DEFAULT 1.0,
+			confirmed BOOLEAN DEFAULT FALSE,
+			created_at INTEGER NOT NULL,
+			FOREIGN KEY (photo_id) REFERENCES photos (id),
+			FOREIGN KEY (person_id) REFERENCES people (id),
+			UNIQUE (photo_id, person_id)
+		);
+		INSERT INTO photo_people_old SELECT * FROM photo_people;
+		DROP TABLE photo_people;
+		ALTER TABLE photo_people_old RENAME TO photo_people;
+		CREATE INDEX idx_photo_people_photo_id ON photo_people (photo_id);
+		CREATE INDEX idx_photo_people_person_id ON photo_people (person_id);
+		`,
+	},
+	{
+		Version: 17,
+		Name:    "mark photo locations checked",
+		// Photos whose EXIF was read before GPS positions were are re-read
+		// once by the importer, which then marks them checked; new photos
+		// are read with positions and start out checked
+		UpSQL: `
+		ALTER TABLE photos ADD COLUMN location_checked BOOLEAN NOT NULL DEFAULT TRUE;
+		UPDATE photos SET location_checked = FALSE
+		WHERE latitude IS NULL AND metadata_json IS NOT NULL
+			AND json_extract(metadata_json, '$.ImageWidth') IS NULL;
+		`,
+		DownSQL: `
+		ALTER TABLE photos DROP COLUMN location_checked;
+		`,
+	},
+	{
+		Version: 18,
+		Name:    "add photo place source",
+		// The version of the gazetteer a photo's place was looked up in. The
+		// importer looks up places again whenever it differs, so every
+		// located photo is looked up once more after this migration.
+		UpSQL: `
+		ALTER TABLE photos ADD COLUMN place_source TEXT;
+		`,
+		DownSQL: `
+		ALTER TABLE photos DROP COLUMN place_source;
+		`,
+	},
+}
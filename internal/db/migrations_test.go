@@ -0,0 +1,76 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// TestMigrateLegacyOrphanedFaceTag migrates a database created before
+// schema_version existed, when foreign keys were not enforced, holding a
+// face tag whose person was deleted
+func TestMigrateLegacyOrphanedFaceTag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photos.db")
+
+	legacy, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = legacy.Exec(migrations[0].UpSQL + `
+		INSERT INTO photos (id, path, filename, imported_at) VALUES (1, '/photos/a.jpg', 'a.jpg', 0);
+		INSERT INTO people (id, name, created_at) VALUES (1, 'Ana', 0);
+		INSERT INTO face_tags (id, photo_filename, person_id, x, y, width, height, created_at)
+		VALUES (1, 'a.jpg', 1, 0, 0, 0.5, 0.5, 0), (2, 'a.jpg', 2, 0.5, 0.5, 0.5, 0.5, 0);
+	`)
+	legacy.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT id, photo_id, person_id FROM face_tags ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	want := []struct {
+		id, photoID int64
+		personID    sql.NullInt64
+	}{
+		{1, 1, sql.NullInt64{Int64: 1, Valid: true}},
+		{2, 1, sql.NullInt64{}}, // Person 2 was deleted
+	}
+	var n int
+	for rows.Next() {
+		var id, photoID int64
+		var personID sql.NullInt64
+		if err := rows.Scan(&id, &photoID, &personID); err != nil {
+			t.Fatal(err)
+		}
+		if n < len(want) && (id != want[n].id || photoID != want[n].photoID || personID != want[n].personID) {
+			t.Errorf("face tag %d: got photo %d, person %v; want photo %d, person %v",
+				id, photoID, personID, want[n].photoID, want[n].personID)
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != len(want) {
+		t.Errorf("got %d face tags, want %d", n, len(want))
+	}
+
+	var violations int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_foreign_key_check").Scan(&violations); err != nil {
+		t.Fatal(err)
+	}
+	if violations != 0 {
+		t.Errorf("got %d foreign key violations after migrating", violations)
+	}
+}
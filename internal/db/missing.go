@@ -0,0 +1,123 @@
+package db
+
+import (
+	"strings"
+	"time"
+)
+
+// GetPhotoByPath retrieves the photo imported from the given file path.
+// Returns sql.ErrNoRows if no photo matches.
+func (db *DB) GetPhotoByPath(path string) (*Photo, error) {
+	p, err := scanPhoto(db.QueryRow("SELECT "+photoColumns+" FROM photos WHERE path = ?", path))
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// UpdatePhotoFile stores what the importer read from a photo's file after it
+// changed on disk or moved: path, filename, capture time, content hash, size,
+// media type, video details, content identifier, position, place and
+// metadata. The missing flag is cleared.
+func (db *DB) UpdatePhotoFile(p *Photo) error {
+	_, err := db.Exec(`
+		UPDATE photos
+		SET path = ?, filename = ?, taken_at = ?, taken_offset = ?, content_hash = ?, file_size = ?,
+			media_type = ?, duration = ?, video_codec = ?, content_identifier = ?,
+			latitude = ?, longitude = ?, altitude = ?, country = ?, region = ?, city = ?,
+			place_source = ?, metadata_json = ?, missing_since = NULL
+		WHERE id = ?
+	`, p.Path, p.Filename, p.TakenAt, p.TakenOffset, p.ContentHash, p.FileSize,
+		p.mediaType(), p.Duration, p.VideoCodec, p.ContentID,
+		p.Latitude, p.Longitude, p.Altitude, p.Country, p.Region, p.City, p.PlaceSource, p.MetadataJSON, p.ID)
+	return err
+}
+
+// RelinkPhoto points a photo at the new location of its file and clears the
+// missing flag. Returns sql.ErrNoRows if the photo does not exist.
+func (db *DB) RelinkPhoto(id int64, path, filename string) error {
+	var relinked int64
+	return db.QueryRow(
+		"UPDATE photos SET path = ?, filename = ?, missing_since = NULL WHERE id = ? RETURNING id",
+		path, filename, id,
+	).Scan(&relinked)
+}
+
+// MarkPhotosMissing flags the photo at path, and every photo below it when
+// path is a directory, as missing from disk. Photos already flagged keep
+// their original timestamp. Returns the IDs of newly flagged photos.
+func (db *DB) MarkPhotosMissing(path string) ([]int64, error) {
+	// '0' sorts right after '/', so the range covers exactly the paths
+	// below the directory without LIKE escaping
+	dir := strings.TrimSuffix(path, "/")
+	rows, err := db.Query(`
+		UPDATE photos
+		SET missing_since = ?
+		WHERE missing_since IS NULL AND (path = ? OR (path > ? AND path < ?))
+		RETURNING id
+	`, time.Now().Unix(), path, dir+"/", dir+"0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetMissingPhotos retrieves photos whose files have disappeared from disk,
+// longest missing first
+func (db *DB) GetMissingPhotos() ([]Photo, error) {
+	rows, err := db.Query(`
+		SELECT ` + photoColumns + `
+		FROM photos
+		WHERE missing_since IS NOT NULL
+		ORDER BY missing_since, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPhotos(rows)
+}
+
+// PruneMissingPhotos deletes photos that have been missing from disk since
+// before the given Unix time, along with their face tags and people links.
+// Returns the IDs of deleted photos.
+func (db *DB) PruneMissingPhotos(before int64) ([]int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Face tags and people links cascade
+	rows, err := tx.Query("DELETE FROM photos WHERE missing_since < ? RETURNING id", before)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, tx.Commit()
+}
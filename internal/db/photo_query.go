@@ -0,0 +1,228 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// PhotoFilter narrows a photo listing. Zero values mean "no filter".
+type PhotoFilter struct {
+	TakenFrom   int64 // Inclusive lower bound on taken_at, Unix seconds
+	TakenBefore int64 // Exclusive upper bound on taken_at, Unix seconds
+	Favorite    *bool
+	PersonID    int64
+	AlbumID     int64
+	FolderID    int64 // Photos directly in the folder, not in its subfolders
+	CameraModel string
+	FileTypes   []string // Extensions without the dot, e.g. "jpg", "heic"
+	MediaType   string   // MediaPhoto or MediaVideo
+	Near        *GeoCircle
+	Country     string // Place names, as stored by the geocoder
+	Region      string
+	City        string
+	Rule        *Rule // A smart album rule
+
+	// IncludeMissing lists photos whose files have disappeared from disk,
+	// which are hidden by default
+	IncludeMissing bool
+}
+
+// PhotoCursor is the position after which the next page of photos starts,
+// following the (taken_at DESC, id DESC) listing order
+type PhotoCursor struct {
+	TakenAt sql.NullInt64
+	ID      int64
+}
+
+// PhotoPage is one page of a photo listing
+type PhotoPage struct {
+	Photos []Photo
+	Total  int
+	Next   *PhotoCursor // nil on the last page
+}
+
+// String encodes the cursor as an opaque URL-safe token
+func (c PhotoCursor) String() string {
+	takenAt := "null"
+	if c.TakenAt.Valid {
+		takenAt = strconv.FormatInt(c.TakenAt.Int64, 10)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(takenAt + "," + strconv.FormatInt(c.ID, 10)))
+}
+
+// ParsePhotoCursor decodes a token produced by PhotoCursor.String
+func ParsePhotoCursor(token string) (*PhotoCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	takenAt, id, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	var c PhotoCursor
+	if c.ID, err = strconv.ParseInt(id, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	if takenAt != "null" {
+		t, err := strconv.ParseInt(takenAt, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		c.TakenAt = sql.NullInt64{Int64: t, Valid: true}
+	}
+
+	return &c, nil
+}
+
+// where builds the SQL conditions and arguments for the filter
+func (f PhotoFilter) where() ([]string, []any) {
+	var conds []string
+	var args []any
+
+	if !f.IncludeMissing {
+		conds = append(conds, "missing_since IS NULL")
+	}
+	// The movie of a Live Photo is shown through its still, and the RAW of a
+	// RAW+JPEG pair through its JPEG
+	conds = append(conds, "NOT EXISTS (SELECT 1 FROM photos s WHERE s.live_video_id = photos.id)")
+	conds = append(conds, "NOT EXISTS (SELECT 1 FROM photos j WHERE j.raw_id = photos.id)")
+	if f.TakenFrom != 0 {
+		conds = append(conds, "taken_at >= ?")
+		args = append(args, f.TakenFrom)
+	}
+	if f.TakenBefore != 0 {
+		conds = append(conds, "taken_at < ?")
+		args = append(args, f.TakenBefore)
+	}
+	if f.Favorite != nil {
+		conds = append(conds, "favorite = ?")
+		args = append(args, *f.Favorite)
+	}
+	if f.PersonID != 0 {
+		conds = append(conds, "EXISTS (SELECT 1 FROM photo_people pp WHERE pp.photo_id = photos.id AND pp.person_id = ?)")
+		args = append(args, f.PersonID)
+	}
+	if f.AlbumID != 0 {
+		conds = append(conds, "EXISTS (SELECT 1 FROM album_photos ap WHERE ap.album_id = ? AND ap.photo_id = photos.id)")
+		args = append(args, f.AlbumID)
+	}
+	if f.FolderID != 0 {
+		conds = append(conds, "folder_id = ?")
+		args = append(args, f.FolderID)
+	}
+	if f.CameraModel != "" {
+		conds = append(conds, "json_extract(metadata_json, '$.Model') = ?")
+		args = append(args, f.CameraModel)
+	}
+	if f.MediaType != "" {
+		conds = append(conds, "media_type = ?")
+		args = append(args, f.MediaType)
+	}
+	if f.Near != nil {
+		cond, nearArgs := f.Near.where()
+		conds = append(conds, cond)
+		args = append(args, nearArgs...)
+	}
+	if f.Country != "" {
+		conds = append(conds, "country = ?")
+		args = append(args, f.Country)
+	}
+	if f.Region != "" {
+		conds = append(conds, "region = ?")
+		args = append(args, f.Region)
+	}
+	if f.City != "" {
+		conds = append(conds, "city = ?")
+		args = append(args, f.City)
+	}
+	if len(f.FileTypes) > 0 {
+		var types []string
+		for _, ext := range f.FileTypes {
+			cond, extArgs := extensionCond(ext)
+			types = append(types, cond)
+			args = append(args, extArgs...)
+		}
+		conds = append(conds, "("+strings.Join(types, " OR ")+")")
+	}
+	if f.Rule != nil {
+		conds = append(conds, "("+f.Rule.cond+")")
+		args = append(args, f.Rule.args...)
+	}
+
+	return conds, args
+}
+
+// extensionCond matches filenames ending in the extension ext, with or
+// without its dot, ignoring case. The suffix is compared exactly rather than
+// with LIKE, where "_" and "%" in ext would be wildcards.
+func extensionCond(ext string) (string, []any) {
+	suffix := "." + strings.ToLower(strings.TrimPrefix(ext, "."))
+	return "lower(substr(filename, -?)) = ?", []any{utf8.RuneCountInString(suffix), suffix}
+}
+
+// ListPhotos returns one page of photos matching the filter, newest first.
+// A zero limit returns every matching photo after the cursor.
+func (db *DB) ListPhotos(filter PhotoFilter, after *PhotoCursor, limit int) (*PhotoPage, error) {
+	conds, args := filter.where()
+
+	whereSQL := ""
+	if len(conds) > 0 {
+		whereSQL = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM photos "+whereSQL, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	// NULL taken_at sorts last in descending order, so a cursor on a dated
+	// photo continues into the undated ones
+	if after != nil {
+		if after.TakenAt.Valid {
+			conds = append(conds, "(taken_at < ? OR (taken_at = ? AND id < ?) OR taken_at IS NULL)")
+			args = append(args, after.TakenAt.Int64, after.TakenAt.Int64, after.ID)
+		} else {
+			conds = append(conds, "(taken_at IS NULL AND id < ?)")
+			args = append(args, after.ID)
+		}
+	}
+
+	query := "SELECT " + photoColumns + " FROM photos"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY taken_at DESC, id DESC"
+
+	// Fetch one extra row to learn whether another page follows
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit+1)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos, err := scanPhotos(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &PhotoPage{Photos: photos, Total: total}
+	if limit > 0 && len(photos) > limit {
+		page.Photos = photos[:limit]
+		last := page.Photos[limit-1]
+		page.Next = &PhotoCursor{TakenAt: last.TakenAt, ID: last.ID}
+	}
+
+	return page, nil
+}
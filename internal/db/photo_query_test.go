@@ -0,0 +1,51 @@
+package db
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestListPhotosFileTypes(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "photos.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, name := range []string{"a.jpg", "b.JPG", "c.png", "d.jpeg", "e_pg", "f.jpg.txt"} {
+		if _, err := db.InsertPhoto(&Photo{Path: "/photos/" + name, Filename: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		types []string
+		want  []string
+	}{
+		{[]string{"jpg"}, []string{"a.jpg", "b.JPG"}},
+		{[]string{".PNG"}, []string{"c.png"}},
+		{[]string{"jpg", "jpeg"}, []string{"a.jpg", "b.JPG", "d.jpeg"}},
+		// Wildcards in the type are matched literally
+		{[]string{"_pg"}, nil},
+		{[]string{"%"}, nil},
+		{[]string{"jp%"}, nil},
+	}
+	for _, tt := range tests {
+		page, err := db.ListPhotos(PhotoFilter{FileTypes: tt.types}, nil, 0)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.types, err)
+		}
+		var got []string
+		for _, p := range page.Photos {
+			got = append(got, p.Filename)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.types, got, tt.want)
+		}
+		if page.Total != len(tt.want) {
+			t.Errorf("%v: total %d, want %d", tt.types, page.Total, len(tt.want))
+		}
+	}
+}
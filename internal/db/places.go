@@ -0,0 +1,231 @@
+package db
+
+import (
+	"database/sql"
+	"math"
+	"strings"
+)
+
+// metresPerDegree is the length of a degree of latitude, and of longitude at
+// the equator
+const metresPerDegree = 111_320
+
+// GeoCircle is the area within Radius metres of a point
+type GeoCircle struct {
+	Latitude  float64
+	Longitude float64
+	Radius    float64
+}
+
+// where returns SQL conditions matching positions inside the circle. A
+// bounding box lets the location index narrow the rows, then distances are
+// compared on an equirectangular projection, which is accurate well beyond
+// the radii a photo search uses.
+func (c GeoCircle) where() (string, []any) {
+	dLat := c.Radius / metresPerDegree
+	scale := math.Cos(c.Latitude * math.Pi / 180)
+	dLon := 180.0
+	if scale > 1e-6 {
+		dLon = min(dLat/scale, 180)
+	}
+
+	cond := `latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?
+		AND (latitude - ?) * (latitude - ?) + (longitude - ?) * ? * (longitude - ?) * ? <= ?`
+	args := []any{
+		c.Latitude - dLat, c.Latitude + dLat, c.Longitude - dLon, c.Longitude + dLon,
+		c.Latitude, c.Latitude, c.Longitude, scale, c.Longitude, scale, dLat * dLat,
+	}
+	return cond, args
+}
+
+// BoundingBox is an area between two latitudes and two longitudes. West is
+// greater than East for boxes crossing the antimeridian.
+type BoundingBox struct {
+	West, South, East, North float64
+}
+
+// where returns SQL conditions matching positions inside the box
+func (b BoundingBox) where() (string, []any) {
+	if b.West <= b.East {
+		return "latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?",
+			[]any{b.South, b.North, b.West, b.East}
+	}
+	return "latitude BETWEEN ? AND ? AND (longitude >= ? OR longitude <= ?)",
+		[]any{b.South, b.North, b.West, b.East}
+}
+
+// PlaceCluster is a group of nearby photos on the map
+type PlaceCluster struct {
+	Latitude  float64 // Mean position of the photos
+	Longitude float64
+	Count     int
+	PhotoID   int64 // The most recently captured photo, to represent the cluster
+	PhotoHash sql.NullString
+}
+
+// clusterCellsPerTile is how many clusters fit across a 256-pixel map tile
+const clusterCellsPerTile = 4
+
+// ListPlaces groups the located photos matching the filter inside box into
+// clusters on a grid whose cells shrink as zoom grows, following web map
+// zoom levels: the world is 2^zoom tiles wide.
+func (db *DB) ListPlaces(filter PhotoFilter, box BoundingBox, zoom int) ([]PlaceCluster, error) {
+	conds, args := filter.where()
+	boxCond, boxArgs := box.where()
+	conds = append(conds, boxCond)
+	args = append(args, boxArgs...)
+
+	cell := 360 / (math.Exp2(float64(zoom)) * clusterCellsPerTile)
+
+	// Offsetting by 180 and 90 keeps cell indexes positive, so truncation
+	// is floor. SQLite fills the bare id and content_hash from the row
+	// holding MAX(taken_at).
+	query := `
+		SELECT AVG(latitude), AVG(longitude), COUNT(*), id, content_hash, MAX(taken_at)
+		FROM photos
+		WHERE ` + strings.Join(conds, " AND ") + `
+		GROUP BY CAST((longitude + 180) / ? AS INTEGER), CAST((latitude + 90) / ? AS INTEGER)
+	`
+	args = append(args, cell, cell)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clusters []PlaceCluster
+	for rows.Next() {
+		var c PlaceCluster
+		var takenAt sql.NullInt64
+		if err := rows.Scan(&c.Latitude, &c.Longitude, &c.Count, &c.PhotoID, &c.PhotoHash, &takenAt); err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters, rows.Err()
+}
+
+// PlaceCount is the number of photos taken in one place. Region and City
+// are empty for photos the geocoder could not name that precisely.
+type PlaceCount struct {
+	Country string
+	Region  string
+	City    string
+	Count   int
+}
+
+// CountPlaces counts the named photos matching the filter per place, ordered
+// by country, region and city
+func (db *DB) CountPlaces(filter PhotoFilter) ([]PlaceCount, error) {
+	conds, args := filter.where()
+	conds = append(conds, "country IS NOT NULL")
+
+	rows, err := db.Query(`
+		SELECT country, COALESCE(region, ''), COALESCE(city, ''), COUNT(*)
+		FROM photos
+		WHERE `+strings.Join(conds, " AND ")+`
+		GROUP BY 1, 2, 3
+		ORDER BY 1, 2, 3
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var places []PlaceCount
+	for rows.Next() {
+		var p PlaceCount
+		if err := rows.Scan(&p.Country, &p.Region, &p.City, &p.Count); err != nil {
+			return nil, err
+		}
+		places = append(places, p)
+	}
+	return places, rows.Err()
+}
+
+// GetPhotosMissingLocation retrieves photos whose stored EXIF was read
+// before positions were and has not been re-read since
+func (db *DB) GetPhotosMissingLocation() ([]Photo, error) {
+	rows, err := db.Query(`
+		SELECT ` + photoColumns + `
+		FROM photos
+		WHERE NOT location_checked
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPhotos(rows)
+}
+
+// SetLocations stores re-read EXIF metadata and the position taken from it
+// for several photos in one transaction, marking their locations checked.
+// Only the Latitude, Longitude, Altitude and MetadataJSON fields of each
+// photo are written.
+func (db *DB) SetLocations(photos []Photo) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE photos SET latitude = ?, longitude = ?, altitude = ?, metadata_json = ?, location_checked = TRUE WHERE id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range photos {
+		if _, err := stmt.Exec(p.Latitude, p.Longitude, p.Altitude, p.MetadataJSON, p.ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetPhotosMissingPlace retrieves located photos whose place was not looked
+// up in the gazetteer of the given version: those imported before places
+// were named, or named by another gazetteer
+func (db *DB) GetPhotosMissingPlace(gazetteer string) ([]Photo, error) {
+	rows, err := db.Query(`
+		SELECT `+photoColumns+`
+		FROM photos
+		WHERE latitude IS NOT NULL AND longitude IS NOT NULL AND place_source IS NOT ?
+		ORDER BY id
+	`, gazetteer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPhotos(rows)
+}
+
+// SetPlaces stores the place names of several photos in one transaction.
+// Only the Country, Region, City and PlaceSource fields of each photo are
+// written.
+func (db *DB) SetPlaces(photos []Photo) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE photos SET country = ?, region = ?, city = ?, place_source = ? WHERE id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range photos {
+		if _, err := stmt.Exec(p.Country, p.Region, p.City, p.PlaceSource, p.ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
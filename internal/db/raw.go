@@ -0,0 +1,77 @@
+package db
+
+import "strings"
+
+// GetUngroupedRawFiles retrieves RAW files on disk, identified by their
+// extensions, that are not yet grouped with a JPEG
+func (db *DB) GetUngroupedRawFiles(extensions []string) ([]Photo, error) {
+	if len(extensions) == 0 {
+		return nil, nil
+	}
+
+	var types []string
+	var args []any
+	for _, ext := range extensions {
+		cond, extArgs := extensionCond(ext)
+		types = append(types, cond)
+		args = append(args, extArgs...)
+	}
+
+	rows, err := db.Query(`
+		SELECT `+photoColumns+`
+		FROM photos
+		WHERE missing_since IS NULL AND (`+strings.Join(types, " OR ")+`)
+			AND NOT EXISTS (SELECT 1 FROM photos j WHERE j.raw_id = photos.id)
+		ORDER BY id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPhotos(rows)
+}
+
+// GetPhotosByStem retrieves photos on disk not grouped with a RAW file whose
+// path is stem plus an extension, e.g. "/photos/IMG_1234.JPG" for stem
+// "/photos/IMG_1234"
+func (db *DB) GetPhotosByStem(stem string) ([]Photo, error) {
+	// '/' sorts right after '.', so the range covers stem.* without LIKE
+	// escaping
+	rows, err := db.Query(`
+		SELECT `+photoColumns+`
+		FROM photos
+		WHERE media_type = ? AND raw_id IS NULL AND missing_since IS NULL AND path > ? AND path < ?
+		ORDER BY id
+	`, MediaPhoto, stem+".", stem+"/")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPhotos(rows)
+}
+
+// SetRawFiles groups JPEGs with their RAW files in one transaction. Only the
+// RawID field of each photo is written.
+func (db *DB) SetRawFiles(photos []Photo) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE photos SET raw_id = ? WHERE id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range photos {
+		if _, err := stmt.Exec(p.RawID, p.ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,431 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule is a compiled smart album rule: a JSON predicate over photos.
+//
+// A rule is an object whose keys are all required to hold. Keys are either
+// combinators, "all" and "any" taking an array of rules and "not" taking one
+// rule, or fields. A field is compared with a value, or with an object of
+// operators that must all hold:
+//
+//	{"all": [
+//		{"favorite": true},
+//		{"person": "Ana"},
+//		{"year": 2022},
+//		{"camera": {"contains": "X100V"}}
+//	]}
+//
+// Operators are eq, ne, gt, gte, lt, lte, in (an array of values) and, for
+// text, contains. See ruleFields for the fields and what they accept.
+type Rule struct {
+	source string
+	cond   string
+	args   []any
+}
+
+// RuleError is a rule that failed to compile. Path is the JSON Pointer of
+// the clause at fault, e.g. "/all/2/year".
+type RuleError struct {
+	Path    string
+	Message string
+}
+
+func (e *RuleError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("invalid rule at %s: %s", path, e.Message)
+}
+
+// ParseRule compiles a rule from its JSON form. Errors are *RuleError.
+func ParseRule(data []byte) (*Rule, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var node any
+	if err := decoder.Decode(&node); err != nil {
+		return nil, &RuleError{Message: "not valid JSON: " + err.Error()}
+	}
+	if decoder.More() {
+		return nil, &RuleError{Message: "unexpected data after the rule"}
+	}
+
+	c := ruleCompiler{}
+	cond, err := c.node("", node)
+	if err != nil {
+		return nil, err
+	}
+
+	var source bytes.Buffer
+	if err := json.Compact(&source, data); err != nil {
+		return nil, &RuleError{Message: "not valid JSON: " + err.Error()}
+	}
+	return &Rule{source: source.String(), cond: cond, args: c.args}, nil
+}
+
+// String returns the rule in its JSON form, as it was parsed
+func (r *Rule) String() string {
+	return r.source
+}
+
+// MarshalJSON encodes the rule in its JSON form
+func (r *Rule) MarshalJSON() ([]byte, error) {
+	return []byte(r.source), nil
+}
+
+// ruleCompiler accumulates the arguments of the SQL being compiled, in the
+// order their placeholders appear
+type ruleCompiler struct {
+	args []any
+}
+
+// node compiles an object of combinators and fields
+func (c *ruleCompiler) node(path string, node any) (string, error) {
+	obj, ok := node.(map[string]any)
+	if !ok {
+		return "", &RuleError{Path: path, Message: "expected an object"}
+	}
+	if len(obj) == 0 {
+		return "", &RuleError{Path: path, Message: "empty rule"}
+	}
+
+	// Sorted for stable SQL, as JSON objects are unordered
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	conds := make([]string, 0, len(keys))
+	for _, key := range keys {
+		keyPath := path + "/" + escapePointer(key)
+		var cond string
+		var err error
+		switch key {
+		case "all", "any":
+			cond, err = c.combinator(keyPath, key, obj[key])
+		case "not":
+			cond, err = c.node(keyPath, obj[key])
+			cond = "NOT (" + cond + ")"
+		default:
+			field, ok := ruleFields[key]
+			if !ok {
+				return "", &RuleError{Path: keyPath, Message: fmt.Sprintf("unknown field %q", key)}
+			}
+			cond, err = field(c, keyPath, obj[key])
+		}
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, cond)
+	}
+	return strings.Join(conds, " AND "), nil
+}
+
+// combinator compiles "all" or "any" over an array of rules
+func (c *ruleCompiler) combinator(path, key string, value any) (string, error) {
+	nodes, ok := value.([]any)
+	if !ok || len(nodes) == 0 {
+		return "", &RuleError{Path: path, Message: "expected a non-empty array of rules"}
+	}
+
+	conds := make([]string, len(nodes))
+	for i, node := range nodes {
+		cond, err := c.node(path+"/"+strconv.Itoa(i), node)
+		if err != nil {
+			return "", err
+		}
+		conds[i] = "(" + cond + ")"
+	}
+
+	join := " AND "
+	if key == "any" {
+		join = " OR "
+	}
+	return "(" + strings.Join(conds, join) + ")", nil
+}
+
+// ruleField compiles the value of a field at path
+type ruleField func(c *ruleCompiler, path string, value any) (string, error)
+
+// ruleFields are the fields rules can test
+var ruleFields = map[string]ruleField{
+	// true or false
+	"favorite": func(c *ruleCompiler, path string, value any) (string, error) {
+		favorite, ok := value.(bool)
+		if !ok {
+			return "", &RuleError{Path: path, Message: "expected true or false"}
+		}
+		c.args = append(c.args, favorite)
+		return "favorite = ?", nil
+	},
+	// Photos with a GPS position (true) or without (false)
+	"located": func(c *ruleCompiler, path string, value any) (string, error) {
+		located, ok := value.(bool)
+		if !ok {
+			return "", &RuleError{Path: path, Message: "expected true or false"}
+		}
+		if located {
+			return "latitude IS NOT NULL", nil
+		}
+		return "latitude IS NULL", nil
+	},
+	// Someone tagged in the photo, by name (any case) or ID: eq, in
+	"person": compareField(ruleText|ruleNumber, []string{"eq", "in"}, func(op string, v any) string {
+		match := "pe.name = ? COLLATE NOCASE"
+		if _, ok := v.(json.Number); ok {
+			match = "pe.id = ?"
+		}
+		return "EXISTS (SELECT 1 FROM photo_people pp JOIN people pe ON pe.id = pp.person_id " +
+			"WHERE pp.photo_id = photos.id AND " + match + ")"
+	}),
+	// A manual album, by ID: eq, in
+	"album": compareField(ruleNumber, []string{"eq", "in"}, func(op string, v any) string {
+		return "EXISTS (SELECT 1 FROM album_photos ap WHERE ap.photo_id = photos.id AND ap.album_id = ?)"
+	}),
+	// Capture date and its parts, in the time zone the photo was taken in
+	"date":  columnField(ruleDate, orderedOps, capturedLocal("%Y-%m-%d")),
+	"year":  columnField(ruleNumber, orderedOps, "CAST("+capturedLocal("%Y")+" AS INTEGER)"),
+	"month": columnField(ruleNumber, orderedOps, "CAST("+capturedLocal("%m")+" AS INTEGER)"),
+	// Common EXIF fields, and any other under "exif", e.g.
+	// {"exif": {"ISO": {"gte": 1600}}}
+	"camera": columnField(ruleText, textOps, "json_extract(metadata_json, '$.Model')"),
+	"make":   columnField(ruleText, textOps, "json_extract(metadata_json, '$.Make')"),
+	"lens":   columnField(ruleText, textOps, "json_extract(metadata_json, '$.LensModel')"),
+	"exif":   exifField,
+	// Place names from the geocoder
+	"country": columnField(ruleText, textOps, "country"),
+	"region":  columnField(ruleText, textOps, "region"),
+	"city":    columnField(ruleText, textOps, "city"),
+	// Within radius metres of a point: {"lat": 38.7, "lon": -9.1, "radius": 5000}
+	"near": nearField,
+	// "photo" or "video"
+	"media_type": columnField(ruleText, []string{"eq", "ne", "in"}, "media_type"),
+	// File extension without the dot, e.g. "heic": eq, in. Wildcards in the
+	// value are escaped so "%" or "jp_" match only themselves.
+	"type": compareField(ruleText, []string{"eq", "in"}, func(op string, v any) string {
+		return `filename LIKE '%.' || ` +
+			`replace(replace(replace(?, '\', '\\'), '%', '\%'), '_', '\_') ESCAPE '\'`
+	}),
+}
+
+// capturedLocal formats the capture time of photos in the zone they were
+// taken in, falling back to the server's when it was not recorded
+func capturedLocal(format string) string {
+	return fmt.Sprintf("CASE WHEN taken_offset IS NULL "+
+		"THEN strftime('%[1]s', taken_at, 'unixepoch', 'localtime') "+
+		"ELSE strftime('%[1]s', taken_at + taken_offset, 'unixepoch') END", format)
+}
+
+// Kinds of values a field accepts
+type ruleKind int
+
+const (
+	ruleText ruleKind = 1 << iota
+	ruleNumber
+	ruleDate // YYYY-MM-DD text
+)
+
+var (
+	orderedOps = []string{"eq", "ne", "gt", "gte", "lt", "lte", "in"}
+	textOps    = []string{"eq", "ne", "in", "contains"}
+	exifOps    = []string{"eq", "ne", "gt", "gte", "lt", "lte", "in", "contains"}
+	sqlOps     = map[string]string{"eq": "=", "ne": "<>", "gt": ">", "gte": ">=", "lt": "<", "lte": "<="}
+)
+
+// columnField compiles comparisons of an SQL expression
+func columnField(kind ruleKind, ops []string, expr string) ruleField {
+	return compareField(kind, ops, func(op string, v any) string {
+		if op == "contains" {
+			return "instr(lower(" + expr + "), lower(?)) > 0"
+		}
+		return expr + " " + sqlOps[op] + " ?"
+	})
+}
+
+// compareField compiles a value, short for {"eq": value}, or an object of
+// operators into conditions built by cond, each taking the compared value as
+// its one argument. "in" becomes an OR of "eq" conditions.
+func compareField(kind ruleKind, ops []string, cond func(op string, v any) string) ruleField {
+	return func(c *ruleCompiler, path string, value any) (string, error) {
+		comparisons, ok := value.(map[string]any)
+		if !ok {
+			return c.compare(kind, cond, path, "eq", value)
+		}
+		if len(comparisons) == 0 {
+			return "", &RuleError{Path: path, Message: "expected a value or operators"}
+		}
+
+		opNames := make([]string, 0, len(comparisons))
+		for op := range comparisons {
+			opNames = append(opNames, op)
+		}
+		slices.Sort(opNames)
+
+		conds := make([]string, 0, len(opNames))
+		for _, op := range opNames {
+			opPath := path + "/" + escapePointer(op)
+			if !slices.Contains(ops, op) {
+				return "", &RuleError{Path: opPath, Message: fmt.Sprintf("unknown operator %q, expected one of %s", op, strings.Join(ops, ", "))}
+			}
+			cond, err := c.compare(kind, cond, opPath, op, comparisons[op])
+			if err != nil {
+				return "", err
+			}
+			conds = append(conds, cond)
+		}
+		return strings.Join(conds, " AND "), nil
+	}
+}
+
+// compare compiles one operator and its value
+func (c *ruleCompiler) compare(kind ruleKind, cond func(op string, v any) string, path, op string, value any) (string, error) {
+	if op != "in" {
+		arg, err := ruleValue(kind, path, value)
+		if err != nil {
+			return "", err
+		}
+		c.args = append(c.args, arg)
+		return cond(op, value), nil
+	}
+
+	values, ok := value.([]any)
+	if !ok || len(values) == 0 {
+		return "", &RuleError{Path: path, Message: "expected a non-empty array"}
+	}
+	alternatives := make([]string, len(values))
+	for i, v := range values {
+		arg, err := ruleValue(kind, path+"/"+strconv.Itoa(i), v)
+		if err != nil {
+			return "", err
+		}
+		c.args = append(c.args, arg)
+		alternatives[i] = cond("eq", v)
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", nil
+}
+
+// ruleValue checks a compared value against the kinds a field accepts and
+// returns its SQL argument
+func ruleValue(kind ruleKind, path string, v any) (any, error) {
+	switch v := v.(type) {
+	case string:
+		if kind&ruleDate != 0 {
+			if _, err := time.Parse("2006-01-02", v); err != nil {
+				return nil, &RuleError{Path: path, Message: fmt.Sprintf("expected a YYYY-MM-DD date, got %q", v)}
+			}
+			return v, nil
+		}
+		if kind&ruleText != 0 {
+			return v, nil
+		}
+	case json.Number:
+		if kind&ruleNumber != 0 {
+			if n, err := v.Int64(); err == nil {
+				return n, nil
+			}
+			if f, err := v.Float64(); err == nil && !math.IsInf(f, 0) {
+				return f, nil
+			}
+		}
+	}
+
+	var expected []string
+	if kind&ruleText != 0 {
+		expected = append(expected, "text")
+	}
+	if kind&ruleNumber != 0 {
+		expected = append(expected, "a number")
+	}
+	if kind&ruleDate != 0 {
+		expected = append(expected, "a YYYY-MM-DD date")
+	}
+	return nil, &RuleError{Path: path, Message: "expected " + strings.Join(expected, " or ")}
+}
+
+// exifTagPattern matches the EXIF tag names metadata is stored under
+var exifTagPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+
+// exifField compiles comparisons of stored EXIF tags: {"ISO": {"gte": 800}}
+func exifField(c *ruleCompiler, path string, value any) (string, error) {
+	tags, ok := value.(map[string]any)
+	if !ok || len(tags) == 0 {
+		return "", &RuleError{Path: path, Message: "expected an object of EXIF tags"}
+	}
+
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var conds []string
+	for _, name := range names {
+		tagPath := path + "/" + escapePointer(name)
+		if !exifTagPattern.MatchString(name) {
+			return "", &RuleError{Path: tagPath, Message: fmt.Sprintf("invalid EXIF tag name %q", name)}
+		}
+		expr := "json_extract(metadata_json, '$." + name + "')"
+		cond, err := columnField(ruleText|ruleNumber, exifOps, expr)(c, tagPath, tags[name])
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, cond)
+	}
+	return strings.Join(conds, " AND "), nil
+}
+
+// nearField compiles {"lat": ..., "lon": ..., "radius": metres}
+func nearField(c *ruleCompiler, path string, value any) (string, error) {
+	obj, ok := value.(map[string]any)
+	if !ok {
+		return "", &RuleError{Path: path, Message: `expected {"lat": ..., "lon": ..., "radius": ...}`}
+	}
+
+	var circle GeoCircle
+	for _, part := range []struct {
+		key      string
+		dest     *float64
+		min, max float64
+	}{
+		{"lat", &circle.Latitude, -90, 90},
+		{"lon", &circle.Longitude, -180, 180},
+		{"radius", &circle.Radius, 0, 20_000_000},
+	} {
+		n, ok := obj[part.key].(json.Number)
+		if !ok {
+			return "", &RuleError{Path: path + "/" + part.key, Message: "expected a number"}
+		}
+		f, err := n.Float64()
+		if err != nil || f < part.min || f > part.max || (part.key == "radius" && f == 0) {
+			return "", &RuleError{Path: path + "/" + part.key, Message: fmt.Sprintf("expected a number between %g and %g", part.min, part.max)}
+		}
+		*part.dest = f
+	}
+	for key := range obj {
+		if key != "lat" && key != "lon" && key != "radius" {
+			return "", &RuleError{Path: path + "/" + escapePointer(key), Message: fmt.Sprintf("unknown key %q", key)}
+		}
+	}
+
+	cond, args := circle.where()
+	c.args = append(c.args, args...)
+	return "(" + cond + ")", nil
+}
+
+// escapePointer escapes a key for use in a JSON Pointer
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"strings"
+)
+
+// PerceptualHash is the perceptual hash of one photo
+type PerceptualHash struct {
+	PhotoID int64
+	Hash    uint64
+}
+
+// SetPerceptualHash stores the perceptual hash of a photo
+func (db *DB) SetPerceptualHash(id int64, hash uint64) error {
+	_, err := db.Exec("UPDATE photos SET phash = ? WHERE id = ?", int64(hash), id)
+	return err
+}
+
+// SetPerceptualHashes stores the perceptual hashes of several photos in one
+// transaction
+func (db *DB) SetPerceptualHashes(hashes []PerceptualHash) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE photos SET phash = ? WHERE id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, h := range hashes {
+		if _, err := stmt.Exec(int64(h.Hash), h.PhotoID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetPhotosMissingPerceptualHash retrieves photos that have not been
+// perceptually hashed yet
+func (db *DB) GetPhotosMissingPerceptualHash() ([]Photo, error) {
+	rows, err := db.Query(`
+		SELECT ` + photoColumns + `
+		FROM photos
+		WHERE phash IS NULL
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPhotos(rows)
+}
+
+// GetPerceptualHashes retrieves the perceptual hash of every hashed photo on
+// disk, ordered by capture time so clusters list burst shots in sequence
+func (db *DB) GetPerceptualHashes() ([]PerceptualHash, error) {
+	rows, err := db.Query(`
+		SELECT id, phash
+		FROM photos
+		WHERE phash IS NOT NULL AND missing_since IS NULL
+		ORDER BY taken_at, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []PerceptualHash
+	for rows.Next() {
+		var h PerceptualHash
+		var stored int64
+		if err := rows.Scan(&h.PhotoID, &stored); err != nil {
+			return nil, err
+		}
+		h.Hash = uint64(stored)
+		hashes = append(hashes, h)
+	}
+
+	return hashes, rows.Err()
+}
+
+// GetPhotosByIDs retrieves the photos with the given IDs, keyed by ID.
+// Unknown IDs are absent from the result.
+func (db *DB) GetPhotosByIDs(ids []int64) (map[int64]Photo, error) {
+	photos := make(map[int64]Photo, len(ids))
+
+	// Stay well under SQLite's bound parameter limit
+	const chunkSize = 500
+	for start := 0; start < len(ids); start += chunkSize {
+		chunk := ids[start:min(start+chunkSize, len(ids))]
+
+		args := make([]any, len(chunk))
+		for i, id := range chunk {
+			args[i] = id
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(chunk)), ",")
+
+		rows, err := db.Query("SELECT "+photoColumns+" FROM photos WHERE id IN ("+placeholders+")", args...)
+		if err != nil {
+			return nil, err
+		}
+
+		found, err := scanPhotos(rows)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range found {
+			photos[p.ID] = p
+		}
+	}
+
+	return photos, nil
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// SmartAlbum is an album of the photos matching a rule, evaluated whenever
+// it is listed
+type SmartAlbum struct {
+	ID         int64
+	Name       string
+	RuleSource string // The rule as stored, in its JSON form
+	Rule       *Rule  // nil when RuleSource no longer compiles
+	RuleError  error  // Why it does not, a *RuleError
+	CreatedAt  int64
+	UpdatedAt  int64
+
+	// Computed for a single album with a valid rule
+	PhotoCount int            // Matching photos on disk
+	CoverID    sql.NullInt64  // The newest of them
+	CoverHash  sql.NullString // Its content hash, to version the thumbnail URL
+}
+
+// querySmartAlbums selects smart albums matching cond, compiling their rules.
+// Albums whose rule no longer compiles are returned with RuleError set.
+func (db *DB) querySmartAlbums(cond string, args ...any) ([]SmartAlbum, error) {
+	rows, err := db.Query(`
+		SELECT id, name, rule, created_at, updated_at
+		FROM smart_albums
+		WHERE `+cond+`
+		ORDER BY name COLLATE NOCASE, id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var albums []SmartAlbum
+	for rows.Next() {
+		var a SmartAlbum
+		if err := rows.Scan(&a.ID, &a.Name, &a.RuleSource, &a.CreatedAt, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+		a.Rule, a.RuleError = ParseRule([]byte(a.RuleSource))
+		albums = append(albums, a)
+	}
+	return albums, rows.Err()
+}
+
+// GetSmartAlbums retrieves all smart albums ordered by name. Their rules are
+// not evaluated, so photo counts and covers are left unset.
+func (db *DB) GetSmartAlbums() ([]SmartAlbum, error) {
+	return db.querySmartAlbums("1")
+}
+
+// GetSmartAlbum retrieves a smart album by ID with, when its rule compiles,
+// its photo count and cover. Returns sql.ErrNoRows if the album does not
+// exist.
+func (db *DB) GetSmartAlbum(id int64) (*SmartAlbum, error) {
+	albums, err := db.querySmartAlbums("id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(albums) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	a := &albums[0]
+	if a.Rule == nil {
+		return a, nil
+	}
+	page, err := db.ListPhotos(PhotoFilter{Rule: a.Rule}, nil, 1)
+	if err != nil {
+		return nil, err
+	}
+	a.PhotoCount = page.Total
+	if len(page.Photos) > 0 {
+		a.CoverID = sql.NullInt64{Int64: page.Photos[0].ID, Valid: true}
+		a.CoverHash = page.Photos[0].ContentHash
+	}
+	return a, nil
+}
+
+// InsertSmartAlbum creates a smart album. Returns ErrAlbumNameTaken if
+// another smart album has the name.
+func (db *DB) InsertSmartAlbum(name string, rule *Rule) (int64, error) {
+	now := time.Now().Unix()
+	result, err := db.Exec(
+		"INSERT INTO smart_albums (name, rule, created_at, updated_at) VALUES (?, ?, ?, ?)",
+		name, rule.String(), now, now,
+	)
+	if err != nil {
+		return 0, smartAlbumNameError(err)
+	}
+	return result.LastInsertId()
+}
+
+// UpdateSmartAlbum sets a smart album's name and rule. Returns sql.ErrNoRows
+// if the album does not exist and ErrAlbumNameTaken if the name is in use.
+func (db *DB) UpdateSmartAlbum(id int64, name string, rule *Rule) error {
+	var updated int64
+	err := db.QueryRow(
+		"UPDATE smart_albums SET name = ?, rule = ?, updated_at = ? WHERE id = ? RETURNING id",
+		name, rule.String(), time.Now().Unix(), id,
+	).Scan(&updated)
+	return smartAlbumNameError(err)
+}
+
+// DeleteSmartAlbum deletes a smart album.
+// Returns sql.ErrNoRows if the album does not exist.
+func (db *DB) DeleteSmartAlbum(id int64) error {
+	var deleted int64
+	return db.QueryRow("DELETE FROM smart_albums WHERE id = ? RETURNING id", id).Scan(&deleted)
+}
+
+// smartAlbumNameError maps a unique constraint failure on smart album names
+// to ErrAlbumNameTaken
+func smartAlbumNameError(err error) error {
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed: smart_albums.name") {
+		return ErrAlbumNameTaken
+	}
+	return err
+}
@@ -0,0 +1,312 @@
+// Package geocode names the place a position lies in, offline, from a
+// GeoNames-style gazetteer: the city closest to it, with the region and
+// country that city belongs to.
+package geocode
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// bundled holds a small gazetteer of major cities in the layout of the
+// GeoNames dumps, so places are named without any download
+//
+//go:embed data
+var bundled embed.FS
+
+const (
+	// earthRadius is the mean radius of the Earth in metres
+	earthRadius = 6_371_000
+
+	// MaxCityDistance is how far from a city, in metres, a position is
+	// still said to be in it. Further away, e.g. at sea, it is not named at
+	// all: the closest city's region and country are only a guess, which
+	// near borders is often wrong with a sparse gazetteer.
+	MaxCityDistance = 50_000
+)
+
+// Files of a gazetteer directory, as distributed by GeoNames
+const (
+	citiesPattern = "cities*.txt" // e.g. cities15000.txt
+	admin1File    = "admin1CodesASCII.txt"
+	countriesFile = "countryInfo.txt"
+)
+
+// Place is where a position lies. Region is empty when the gazetteer has no
+// name for it.
+type Place struct {
+	Country string
+	Region  string
+	City    string
+}
+
+// Name returns the place as it is usually written, e.g. "Lisbon, Portugal"
+func (p Place) Name() string {
+	var parts []string
+	switch {
+	case p.City != "":
+		parts = append(parts, p.City)
+	case p.Region != "":
+		parts = append(parts, p.Region)
+	}
+	if p.Country != "" {
+		parts = append(parts, p.Country)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// city is a gazetteer entry, positioned on the unit sphere
+type city struct {
+	place Place
+	pos   [3]float64
+}
+
+// Geocoder finds the place of positions. It is safe for concurrent use.
+type Geocoder struct {
+	cities  []city // A k-d tree: each median splits its range on pos[depth%3]
+	version string
+}
+
+var bundledGeocoder = sync.OnceValue(func() *Geocoder {
+	dir, err := fs.Sub(bundled, "data")
+	if err != nil {
+		panic(err)
+	}
+	g, err := Load(dir)
+	if err != nil {
+		panic(fmt.Sprintf("geocode: bundled gazetteer: %v", err))
+	}
+	return g
+})
+
+// Bundled returns the geocoder of the gazetteer built into the binary
+func Bundled() *Geocoder {
+	return bundledGeocoder()
+}
+
+// Load reads a gazetteer directory in the GeoNames layout: a cities file
+// (cities500.txt, cities15000.txt, ...), admin1CodesASCII.txt naming regions
+// and countryInfo.txt naming countries. Without the last two, regions are
+// left unnamed and countries go by their ISO code.
+func Load(dir fs.FS) (*Geocoder, error) {
+	matches, err := fs.Glob(dir, citiesPattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no %s file", citiesPattern)
+	}
+
+	// The version hashes every file read, in a fixed order
+	sum := sha256.New()
+	regions, err := readNames(dir, admin1File, 1, sum)
+	if err != nil {
+		return nil, err
+	}
+	countries, err := readNames(dir, countriesFile, 4, sum)
+	if err != nil {
+		return nil, err
+	}
+
+	name := largestCitiesFile(matches)
+	cities, err := readCities(dir, name, regions, countries, sum)
+	if err != nil {
+		return nil, err
+	}
+	if len(cities) == 0 {
+		return nil, fmt.Errorf("%s: no cities", name)
+	}
+
+	buildTree(cities, 0)
+	return &Geocoder{cities: cities, version: hex.EncodeToString(sum.Sum(nil))[:16]}, nil
+}
+
+// Version identifies the gazetteer the geocoder was loaded from, changing
+// with any of its files, so places named by another one can be told apart
+func (g *Geocoder) Version() string {
+	return g.version
+}
+
+// largestCitiesFile picks among GeoNames cities files, which overlap, the
+// one with the lowest population threshold: cities500.txt lists every city
+// of cities15000.txt and more
+func largestCitiesFile(names []string) string {
+	threshold := func(name string) int {
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(path.Base(name), "cities"), ".txt"))
+		if err != nil {
+			return 0
+		}
+		return n
+	}
+	sort.Slice(names, func(i, j int) bool { return threshold(names[i]) < threshold(names[j]) })
+	return names[0]
+}
+
+// readNames maps the first column of a tab-separated GeoNames file to its
+// column'th one. A missing file maps nothing.
+func readNames(dir fs.FS, name string, column int, sum io.Writer) (map[string]string, error) {
+	names := make(map[string]string)
+	err := readRows(dir, name, sum, func(fields []string) {
+		if len(fields) > column {
+			names[fields[0]] = fields[column]
+		}
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return names, nil
+}
+
+// GeoNames cities file columns
+const (
+	cityName      = 1
+	cityLatitude  = 4
+	cityLongitude = 5
+	cityCountry   = 8
+	cityAdmin1    = 10
+	cityColumns   = 11
+)
+
+// readCities reads the entries of a GeoNames cities file
+func readCities(dir fs.FS, name string, regions, countries map[string]string, sum io.Writer) ([]city, error) {
+	var cities []city
+	var bad int
+	err := readRows(dir, name, sum, func(fields []string) {
+		if len(fields) < cityColumns {
+			bad++
+			return
+		}
+		lat, err1 := strconv.ParseFloat(fields[cityLatitude], 64)
+		lon, err2 := strconv.ParseFloat(fields[cityLongitude], 64)
+		if err1 != nil || err2 != nil {
+			bad++
+			return
+		}
+
+		code := fields[cityCountry]
+		country := countries[code]
+		if country == "" {
+			country = code
+		}
+		cities = append(cities, city{
+			place: Place{
+				Country: country,
+				Region:  regions[code+"."+fields[cityAdmin1]],
+				City:    fields[cityName],
+			},
+			pos: unitVector(lat, lon),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if bad > 0 && len(cities) == 0 {
+		return nil, fmt.Errorf("%s: not a GeoNames cities file", name)
+	}
+	return cities, nil
+}
+
+// readRows calls fn with the tab-separated fields of each line of a file,
+// skipping blank lines and # comments. The file's bytes are copied to sum.
+func readRows(dir fs.FS, name string, sum io.Writer, fn func(fields []string)) error {
+	f, err := dir.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(io.TeeReader(f, sum))
+	// Alternate names make some lines of the larger dumps long
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fn(strings.Split(line, "\t"))
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", path.Base(name), err)
+	}
+	return nil
+}
+
+// Lookup returns the place of a position in signed decimal degrees, or false
+// when no city lies within MaxCityDistance of it
+func (g *Geocoder) Lookup(latitude, longitude float64) (Place, bool) {
+	target := unitVector(latitude, longitude)
+	best, bestChord := -1, math.Inf(1)
+	g.nearest(0, len(g.cities), 0, target, &best, &bestChord)
+	if best < 0 || chordDistance(bestChord) > MaxCityDistance {
+		return Place{}, false
+	}
+	return g.cities[best].place, true
+}
+
+// buildTree arranges cities into a k-d tree in place
+func buildTree(cities []city, depth int) {
+	if len(cities) <= 1 {
+		return
+	}
+	axis := depth % 3
+	sort.Slice(cities, func(i, j int) bool { return cities[i].pos[axis] < cities[j].pos[axis] })
+
+	mid := len(cities) / 2
+	buildTree(cities[:mid], depth+1)
+	buildTree(cities[mid+1:], depth+1)
+}
+
+// nearest searches the subtree of cities[lo:hi] for the city closest to
+// target, updating best and its squared chord length
+func (g *Geocoder) nearest(lo, hi, depth int, target [3]float64, best *int, bestChord *float64) {
+	if lo >= hi {
+		return
+	}
+	mid := lo + (hi-lo)/2
+	if d := squaredDistance(g.cities[mid].pos, target); d < *bestChord {
+		*best, *bestChord = mid, d
+	}
+
+	axis := depth % 3
+	diff := target[axis] - g.cities[mid].pos[axis]
+	nearLo, nearHi, farLo, farHi := lo, mid, mid+1, hi
+	if diff > 0 {
+		nearLo, nearHi, farLo, farHi = mid+1, hi, lo, mid
+	}
+	g.nearest(nearLo, nearHi, depth+1, target, best, bestChord)
+	if diff*diff < *bestChord {
+		g.nearest(farLo, farHi, depth+1, target, best, bestChord)
+	}
+}
+
+// unitVector returns the point of the unit sphere at a position. Straight
+// line distances between such points order positions like great-circle
+// distances, across the antimeridian and poles alike.
+func unitVector(latitude, longitude float64) [3]float64 {
+	lat := latitude * math.Pi / 180
+	lon := longitude * math.Pi / 180
+	return [3]float64{math.Cos(lat) * math.Cos(lon), math.Cos(lat) * math.Sin(lon), math.Sin(lat)}
+}
+
+func squaredDistance(a, b [3]float64) float64 {
+	dx, dy, dz := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return dx*dx + dy*dy + dz*dz
+}
+
+// chordDistance converts the squared chord between two unit vectors to the
+// great-circle distance between their positions, in metres
+func chordDistance(squared float64) float64 {
+	return 2 * math.Asin(min(math.Sqrt(squared)/2, 1)) * earthRadius
+}
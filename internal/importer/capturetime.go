@@ -0,0 +1,177 @@
+package importer
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vieira/tidyphotos/internal/db"
+)
+
+// CaptureTime is when a photo was taken. HasOffset reports whether the
+// source recorded a UTC offset; without one the time is wall-clock time in
+// the server's local zone.
+type CaptureTime struct {
+	Time      time.Time
+	HasOffset bool
+	Source    string // "exif", "filename" or "mtime"
+}
+
+// Layouts exiftool uses for date/time tags. Parsing accepts subseconds after
+// the seconds field without them being in the layout.
+const (
+	exifZonedTimeLayout = "2006:01:02 15:04:05Z07:00"
+	exifLocalTimeLayout = "2006:01:02 15:04:05"
+)
+
+// filenameTimePatterns match timestamps phones and cameras put in filenames,
+// e.g. IMG_20230514_103000.jpg, PXL_20230514_103000123.jpg,
+// Screenshot_2023-05-14-10-30-00.png or "2023-05-14 10.30.00.jpg"
+var filenameTimePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?:^|\D)((?:19|20)\d{2})-?(\d{2})-?(\d{2})[_\- T]?(\d{2})[\-_.:]?(\d{2})[\-_.:]?(\d{2})(?:\D|$|\d{3}\D)`),
+	regexp.MustCompile(`(?:^|\D)((?:19|20)\d{2})-?(\d{2})-?(\d{2})(?:\D|$)`),
+}
+
+// DetermineCaptureTime picks the capture time of a photo from, in order, its
+// EXIF date tags, a timestamp in its filename, and the file modification time.
+// info may be nil, in which case the file is stat'ed; ok is false only when
+// every source failed.
+func DetermineCaptureTime(path string, exif *EXIFData, info os.FileInfo) (ct CaptureTime, ok bool) {
+	if exif != nil {
+		if ct, ok := exifCaptureTime(exif); ok {
+			return ct, true
+		}
+	}
+
+	if t, ok := parseFilenameTime(filepath.Base(path)); ok {
+		return CaptureTime{Time: t, Source: "filename"}, true
+	}
+
+	if info == nil {
+		var err error
+		if info, err = os.Stat(path); err != nil {
+			return CaptureTime{}, false
+		}
+	}
+	return CaptureTime{Time: info.ModTime(), Source: "mtime"}, true
+}
+
+// apply stores the capture time on a photo row
+func (ct CaptureTime) apply(p *db.Photo) {
+	p.TakenAt = sql.NullInt64{Int64: ct.Time.Unix(), Valid: true}
+	p.TakenOffset = sql.NullInt64{}
+	if ct.HasOffset {
+		_, offset := ct.Time.Zone()
+		p.TakenOffset = sql.NullInt64{Int64: int64(offset), Valid: true}
+	}
+}
+
+// exifCaptureTime reads DateTimeOriginal, falling back to CreateDate and
+// then a video's MediaCreateDate, and applies the matching OffsetTime* tag
+// when the date carries no zone itself
+func exifCaptureTime(exif *EXIFData) (CaptureTime, bool) {
+	candidates := []struct{ value, offset string }{
+		{exif.DateTimeOriginal, exif.OffsetTimeOriginal},
+		{exif.CreateDate, exif.OffsetTimeDigitized},
+	}
+
+	for _, c := range candidates {
+		if t, hasOffset, ok := parseEXIFTime(c.value, firstNonEmpty(c.offset, exif.OffsetTime)); ok {
+			return CaptureTime{Time: t, HasOffset: hasOffset, Source: "exif"}, true
+		}
+	}
+
+	// A movie's creation time is a UTC instant; the local zone is unknown
+	if t, _, ok := parseEXIFTime(exif.MediaCreateDate, "+00:00"); ok {
+		return CaptureTime{Time: t, Source: "exif"}, true
+	}
+	return CaptureTime{}, false
+}
+
+// parseEXIFTime parses an exiftool date/time string. An inline zone wins over
+// the separate offset tag; with neither the time is read in the local zone.
+func parseEXIFTime(value, offset string) (t time.Time, hasOffset, ok bool) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.HasPrefix(value, "0000") {
+		return time.Time{}, false, false
+	}
+
+	if t, err := time.Parse(exifZonedTimeLayout, value); err == nil {
+		return t, true, true
+	}
+
+	loc := time.Local
+	if zone, ok := parseUTCOffset(offset); ok {
+		loc, hasOffset = zone, true
+	}
+	t, err := time.ParseInLocation(exifLocalTimeLayout, value, loc)
+	if err != nil {
+		return time.Time{}, false, false
+	}
+	return t, hasOffset, true
+}
+
+// parseUTCOffset parses EXIF OffsetTime values such as "+01:00" or "-0530"
+func parseUTCOffset(offset string) (*time.Location, bool) {
+	offset = strings.ReplaceAll(strings.TrimSpace(offset), ":", "")
+	if len(offset) != 5 || (offset[0] != '+' && offset[0] != '-') {
+		return nil, false
+	}
+
+	hours, err := strconv.Atoi(offset[1:3])
+	if err != nil {
+		return nil, false
+	}
+	minutes, err := strconv.Atoi(offset[3:5])
+	if err != nil || hours > 14 || minutes > 59 {
+		return nil, false
+	}
+
+	seconds := hours*3600 + minutes*60
+	if offset[0] == '-' {
+		seconds = -seconds
+	}
+	return time.FixedZone("", seconds), true
+}
+
+// parseFilenameTime extracts a timestamp embedded in a filename. Date-only
+// matches are placed at midnight local time.
+func parseFilenameTime(name string) (time.Time, bool) {
+	for _, pattern := range filenameTimePatterns {
+		m := pattern.FindStringSubmatch(name)
+		if m == nil {
+			continue
+		}
+
+		parts := make([]int, 6)
+		for i := 1; i < len(m) && i <= 6; i++ {
+			parts[i-1], _ = strconv.Atoi(m[i])
+		}
+
+		t := time.Date(parts[0], time.Month(parts[1]), parts[2], parts[3], parts[4], parts[5], 0, time.Local)
+
+		// time.Date normalizes out-of-range values; reject anything it changed
+		if t.Year() != parts[0] || int(t.Month()) != parts[1] || t.Day() != parts[2] ||
+			t.Hour() != parts[3] || t.Minute() != parts[4] || t.Second() != parts[5] {
+			continue
+		}
+		if t.After(time.Now().AddDate(0, 0, 1)) {
+			continue
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+)
+
+// hashFile returns the hex SHA-256 of a file's bytes and its size
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// backfillContentHash hashes photos imported before content hashes were
+// tracked. Photos whose file is gone are left unhashed.
+func (imp *Importer) backfillContentHash() error {
+	photos, err := imp.db.GetPhotosMissingContentHash()
+	if err != nil {
+		return err
+	}
+	if len(photos) == 0 {
+		return nil
+	}
+
+	log.Printf("🔑 Hashing %d previously imported photos...", len(photos))
+
+	hashed := photos[:0]
+	for _, photo := range photos {
+		hash, size, err := hashFile(photo.Path)
+		if err != nil {
+			log.Printf("⚠️  Failed to hash %s: %v", photo.Filename, err)
+			continue
+		}
+		photo.ContentHash = sql.NullString{String: hash, Valid: true}
+		photo.FileSize = sql.NullInt64{Int64: size, Valid: true}
+		hashed = append(hashed, photo)
+	}
+
+	return imp.db.SetContentHashes(hashed)
+}
@@ -0,0 +1,311 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EXIFReader reads the EXIF metadata of photo files. Implementations must be
+// safe for concurrent use; tests can substitute a fake with SetEXIFReader.
+type EXIFReader interface {
+	// ReadEXIF reads several files in one call. Files exiftool could not
+	// read are absent from the result; err is only set when nothing could
+	// be read at all.
+	ReadEXIF(paths ...string) (map[string]*EXIFData, error)
+	Close() error
+}
+
+// exifTags are the tags requested from exiftool, matching EXIFData
+var exifTags = []string{
+	"-DateTimeOriginal",
+	"-CreateDate",
+	"-OffsetTime",
+	"-OffsetTimeOriginal",
+	"-OffsetTimeDigitized",
+	"-Make",
+	"-Model",
+	"-LensModel",
+	"-ISO",
+	"-FNumber",
+	"-ExposureTime",
+	"-FocalLength",
+	"-SubSecTimeOriginal",
+	"-ContentIdentifier",
+	// Numeric values (#) rather than exiftool's printed forms
+	"-Orientation#",
+	"-ImageWidth#",
+	"-ImageHeight#",
+	"-GPSLatitude#",
+	"-GPSLatitudeRef#",
+	"-GPSLongitude#",
+	"-GPSLongitudeRef#",
+	"-GPSAltitude#",
+	"-GPSAltitudeRef#",
+}
+
+// exifToolTimeout bounds one request; a process that exceeds it is killed
+// and restarted
+const exifToolTimeout = 60 * time.Second
+
+// ExifTool is an EXIFReader backed by long-running `exiftool -stay_open`
+// processes, which avoids paying Perl's startup cost for every photo.
+// Requests from concurrent callers are spread over a fixed number of
+// processes; a process that crashes or hangs is restarted and the request
+// retried once.
+type ExifTool struct {
+	sessions chan *exifToolSession
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// NewExifTool creates a reader with up to n exiftool processes. Processes
+// are started on first use.
+func NewExifTool(n int) *ExifTool {
+	if n < 1 {
+		n = 1
+	}
+	et := &ExifTool{
+		sessions: make(chan *exifToolSession, n),
+		closed:   make(chan struct{}),
+	}
+	for range n {
+		et.sessions <- &exifToolSession{}
+	}
+	return et
+}
+
+// ReadEXIF implements EXIFReader
+func (et *ExifTool) ReadEXIF(paths ...string) (map[string]*EXIFData, error) {
+	if len(paths) == 0 {
+		return map[string]*EXIFData{}, nil
+	}
+
+	// -@ reads one argument per line
+	for _, path := range paths {
+		if strings.ContainsAny(path, "\r\n") {
+			return nil, fmt.Errorf("unsupported newline in path %q", path)
+		}
+	}
+
+	var s *exifToolSession
+	select {
+	case s = <-et.sessions:
+	case <-et.closed:
+		return nil, errors.New("exiftool is closed")
+	}
+	defer func() { et.sessions <- s }()
+
+	output, err := s.execute(append(append([]string{"-json"}, exifTags...), paths...))
+	if err != nil {
+		// The process may have crashed mid-request; retry once on a fresh one
+		s.stop()
+		if output, err = s.execute(append(append([]string{"-json"}, exifTags...), paths...)); err != nil {
+			s.stop()
+			return nil, err
+		}
+	}
+
+	return parseExifToolJSON(output)
+}
+
+// Close stops every exiftool process. Further reads fail.
+func (et *ExifTool) Close() error {
+	et.once.Do(func() { close(et.closed) })
+
+	// Wait for in-flight requests by taking every session back
+	for range cap(et.sessions) {
+		s := <-et.sessions
+		s.stop()
+	}
+	return nil
+}
+
+// parseExifToolJSON maps exiftool's -json output to the files it describes
+func parseExifToolJSON(output []byte) (map[string]*EXIFData, error) {
+	result := make(map[string]*EXIFData)
+
+	// Unreadable files produce no entry, and exiftool prints nothing at all
+	// when none of the files could be read
+	if len(bytes.TrimSpace(output)) == 0 {
+		return result, nil
+	}
+
+	// Each file is decoded on its own, so a tag of an unexpected type only
+	// sends that file to the fallback reader
+	var elements []json.RawMessage
+	if err := json.Unmarshal(output, &elements); err != nil {
+		return nil, fmt.Errorf("failed to parse exiftool output: %w", err)
+	}
+
+	for _, element := range elements {
+		path, data, err := parseExifToolEntry(element)
+		if err != nil {
+			log.Printf("⚠️  Failed to parse exiftool output for %s: %v", path, err)
+			continue
+		}
+		result[path] = data
+	}
+	return result, nil
+}
+
+// parseExifToolEntry decodes the -json output for one file. The file's path
+// is returned even when the rest fails to decode, if it can be read.
+func parseExifToolEntry(element json.RawMessage) (string, *EXIFData, error) {
+	// Fields declared here shadow EXIFData's and are folded into it below
+	var e struct {
+		SourceFile string `json:"SourceFile"`
+		EXIFData
+		// Printed as numbers when they look like one, and as strings
+		// otherwise, e.g. "045" or "1/250"
+		SubSecTimeOriginal json.RawMessage `json:"SubSecTimeOriginal"`
+		ExposureTime       json.RawMessage `json:"ExposureTime"`
+		GPSLatitudeRef     string          `json:"GPSLatitudeRef"`
+		GPSLongitudeRef    string          `json:"GPSLongitudeRef"`
+		GPSAltitudeRef     int             `json:"GPSAltitudeRef"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(element))
+	dec.UseNumber()
+	if err := dec.Decode(&e); err != nil {
+		var source struct {
+			SourceFile string `json:"SourceFile"`
+		}
+		json.Unmarshal(element, &source)
+		return source.SourceFile, nil, err
+	}
+
+	e.EXIFData.SubSecTimeOriginal = jsonText(e.SubSecTimeOriginal)
+	e.EXIFData.ExposureTime = jsonText(e.ExposureTime)
+
+	// Plain EXIF coordinates are unsigned; the Ref tags carry the sign
+	if e.GPSLatitude != nil && *e.GPSLatitude > 0 && e.GPSLatitudeRef == "S" {
+		*e.GPSLatitude = -*e.GPSLatitude
+	}
+	if e.GPSLongitude != nil && *e.GPSLongitude > 0 && e.GPSLongitudeRef == "W" {
+		*e.GPSLongitude = -*e.GPSLongitude
+	}
+	if e.GPSAltitude != nil && *e.GPSAltitude > 0 && e.GPSAltitudeRef == 1 {
+		*e.GPSAltitude = -*e.GPSAltitude
+	}
+
+	return e.SourceFile, &e.EXIFData, nil
+}
+
+// jsonText returns a JSON string or number as text, and "" for anything else
+func jsonText(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n.String()
+	}
+	return ""
+}
+
+// exifToolSession is one `exiftool -stay_open True -@ -` process. It is used
+// by one request at a time.
+type exifToolSession struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	seq    int
+}
+
+func (s *exifToolSession) start() error {
+	cmd := exec.Command("exiftool", "-stay_open", "True", "-@", "-")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	// Per-file warnings go to stderr; missing entries in the JSON report them
+	cmd.Stderr = io.Discard
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	s.cmd = cmd
+	s.stdin = stdin
+	s.stdout = bufio.NewReaderSize(stdout, 64*1024)
+	return nil
+}
+
+// execute runs one exiftool command and returns its standard output
+func (s *exifToolSession) execute(args []string) ([]byte, error) {
+	if s.cmd == nil {
+		if err := s.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Numbered -execute markers make exiftool echo {readyN}, so output left
+	// over from an earlier, abandoned request is never mistaken for ours
+	s.seq++
+	ready := fmt.Sprintf("{ready%d}", s.seq)
+
+	var req strings.Builder
+	for _, arg := range args {
+		req.WriteString(arg)
+		req.WriteByte('\n')
+	}
+	fmt.Fprintf(&req, "-execute%d\n", s.seq)
+
+	// A hung process is killed, which unblocks the read below
+	cmd := s.cmd
+	timer := time.AfterFunc(exifToolTimeout, func() { cmd.Process.Kill() })
+	defer timer.Stop()
+
+	if _, err := io.WriteString(s.stdin, req.String()); err != nil {
+		return nil, fmt.Errorf("exiftool write failed: %w", err)
+	}
+
+	var out bytes.Buffer
+	for {
+		line, err := s.stdout.ReadBytes('\n')
+		if err != nil {
+			return nil, fmt.Errorf("exiftool read failed: %w", err)
+		}
+		if strings.TrimRight(string(line), "\r\n") == ready {
+			return out.Bytes(), nil
+		}
+		out.Write(line)
+	}
+}
+
+// stop ends the process, politely if it is still responsive
+func (s *exifToolSession) stop() {
+	if s.cmd == nil {
+		return
+	}
+
+	io.WriteString(s.stdin, "-stay_open\nFalse\n")
+	s.stdin.Close()
+
+	done := make(chan struct{})
+	go func() {
+		s.cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		s.cmd.Process.Kill()
+		<-done
+	}
+
+	s.cmd = nil
+}
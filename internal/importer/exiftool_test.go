@@ -0,0 +1,57 @@
+package importer
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseExifToolJSON(t *testing.T) {
+	output, err := os.ReadFile("testdata/exiftool.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := parseExifToolJSON(output)
+	if err != nil {
+		t.Fatalf("parseExifToolJSON: %v", err)
+	}
+	// A file with a tag of an unexpected type is left to the fallback
+	// reader, without failing the others
+	if len(result) != 3 {
+		t.Fatalf("got %d entries, want 3", len(result))
+	}
+	if _, ok := result["/photos/iso-text.jpg"]; ok {
+		t.Errorf("/photos/iso-text.jpg: got an entry for an ISO that is not a number")
+	}
+
+	tests := []struct {
+		file         string
+		subSec       string
+		exposureTime string
+	}{
+		{"/photos/padded.jpg", "045", "1/250"}, // Zero-padded values are quoted
+		{"/photos/unpadded.jpg", "450", "1"},   // Others are printed as numbers
+		{"/photos/bare.jpg", "", ""},
+	}
+	for _, tt := range tests {
+		data := result[tt.file]
+		if data == nil {
+			t.Errorf("%s: missing from result", tt.file)
+			continue
+		}
+		if data.SubSecTimeOriginal != tt.subSec {
+			t.Errorf("%s: SubSecTimeOriginal = %q, want %q", tt.file, data.SubSecTimeOriginal, tt.subSec)
+		}
+		if data.ExposureTime != tt.exposureTime {
+			t.Errorf("%s: ExposureTime = %q, want %q", tt.file, data.ExposureTime, tt.exposureTime)
+		}
+	}
+
+	padded := result["/photos/padded.jpg"]
+	if padded.Model != "X100V" || padded.ISO != 160 {
+		t.Errorf("padded: Model = %q, ISO = %d", padded.Model, padded.ISO)
+	}
+	if padded.GPSLongitude == nil || *padded.GPSLongitude != -9.1393 {
+		t.Errorf("padded: GPSLongitude = %v, want -9.1393", padded.GPSLongitude)
+	}
+}
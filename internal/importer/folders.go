@@ -0,0 +1,16 @@
+package importer
+
+import "log"
+
+// syncFolders links photos to the folder of the photos directory they are in,
+// following files that moved since the last sync
+func (imp *Importer) syncFolders() {
+	n, err := imp.db.SyncFolders(imp.photosDir)
+	if err != nil {
+		log.Printf("⚠️  Failed to sync folders: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("📁 Filed %d photos into folders", n)
+	}
+}
@@ -1,22 +1,45 @@
 package importer
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/vieira/tidyphotos/internal/db"
+	"github.com/vieira/tidyphotos/internal/geocode"
 )
 
 type Importer struct {
 	db        *db.DB
 	photosDir string
 	thumbsDir string
+	workers   int
+	thumbs    ThumbnailGenerator
+
+	renditionsDir string
+	renderMu      sync.Mutex
+	rendering     map[string]chan struct{} // Closed when the rendition is done
+	renderSem     chan struct{}
+
+	transcodesDir      string
+	transcodeMu        sync.Mutex
+	transcodeCacheSize int64
+	transcodeUsed      map[string]time.Time // Path -> last served, since startup
+
+	exifMu sync.Mutex
+	exif   EXIFReader // Created on first use unless set with SetEXIFReader
+
+	geocoder *geocode.Geocoder
+
+	mu       sync.Mutex
+	progress ImportProgress
 }
 
 func New(database *db.DB, photosDir, thumbsDir string) *Importer {
@@ -24,42 +47,162 @@ func New(database *db.DB, photosDir, thumbsDir string) *Importer {
 		db:        database,
 		photosDir: photosDir,
 		thumbsDir: thumbsDir,
+		workers:   runtime.NumCPU(),
+		thumbs:    DefaultThumbnailGenerator,
+		// Renditions and transcodes live next to the thumbnails in the
+		// cache directory
+		renditionsDir:      filepath.Join(filepath.Dir(thumbsDir), "renditions"),
+		rendering:          make(map[string]chan struct{}),
+		renderSem:          make(chan struct{}, runtime.NumCPU()),
+		transcodesDir:      filepath.Join(filepath.Dir(thumbsDir), "transcodes"),
+		transcodeCacheSize: DefaultTranscodeCacheSize,
+		transcodeUsed:      make(map[string]time.Time),
+		geocoder:           geocode.Bundled(),
+	}
+}
+
+// SetWorkers sets how many files are read and thumbnailed concurrently
+// during a scan. The default is the number of CPUs.
+func (imp *Importer) SetWorkers(n int) {
+	if n < 1 {
+		n = 1
 	}
+	imp.workers = n
+}
+
+// SetThumbnailGenerator replaces the generator used for new thumbnails. The
+// default tries vips, then sips, then the built-in generator.
+func (imp *Importer) SetThumbnailGenerator(g ThumbnailGenerator) {
+	imp.thumbs = g
+}
+
+// SetEXIFReader replaces the exiftool-backed metadata reader, e.g. with a
+// fake in tests. The importer closes the reader in Close.
+func (imp *Importer) SetEXIFReader(r EXIFReader) {
+	imp.exifMu.Lock()
+	defer imp.exifMu.Unlock()
+
+	if imp.exif != nil {
+		imp.exif.Close()
+	}
+	imp.exif = r
+}
+
+// exifReader returns the metadata reader, created on first use: exiftool
+// with one session per worker, falling back to the built-in reader
+func (imp *Importer) exifReader() EXIFReader {
+	imp.exifMu.Lock()
+	defer imp.exifMu.Unlock()
+
+	if imp.exif == nil {
+		imp.exif = defaultEXIFReader(imp.workers)
+	}
+	return imp.exif
+}
+
+// Close releases the importer's external processes
+func (imp *Importer) Close() error {
+	imp.exifMu.Lock()
+	defer imp.exifMu.Unlock()
+
+	if imp.exif == nil {
+		return nil
+	}
+	err := imp.exif.Close()
+	imp.exif = nil
+	return err
 }
 
 // EXIFData represents the EXIF metadata we care about
 type EXIFData struct {
-	DateTimeOriginal string      `json:"DateTimeOriginal"`
-	CreateDate       string      `json:"CreateDate"`
-	Make             string      `json:"Make"`
-	Model            string      `json:"Model"`
-	LensModel        string      `json:"LensModel"`
-	ISO              int         `json:"ISO"`
-	FNumber          interface{} `json:"FNumber"` // Can be string or number
-	ExposureTime     string      `json:"ExposureTime"`
-	FocalLength      string      `json:"FocalLength"`
-}
-
-// ScanAndImport scans the photos directory and imports new photos
+	DateTimeOriginal    string      `json:"DateTimeOriginal"`
+	CreateDate          string      `json:"CreateDate"`
+	OffsetTime          string      `json:"OffsetTime,omitempty"`
+	OffsetTimeOriginal  string      `json:"OffsetTimeOriginal,omitempty"`
+	OffsetTimeDigitized string      `json:"OffsetTimeDigitized,omitempty"`
+	Make                string      `json:"Make"`
+	Model               string      `json:"Model"`
+	LensModel           string      `json:"LensModel"`
+	ISO                 int         `json:"ISO"`
+	FNumber             interface{} `json:"FNumber"` // Can be string or number
+	ExposureTime        string      `json:"ExposureTime"`
+	FocalLength         string      `json:"FocalLength"`
+	SubSecTimeOriginal  string      `json:"SubSecTimeOriginal,omitempty"`
+	Orientation         int         `json:"Orientation,omitempty"` // 1-8, as in the EXIF tag
+	ImageWidth          int         `json:"ImageWidth,omitempty"`
+	ImageHeight         int         `json:"ImageHeight,omitempty"`
+	GPSLatitude         *float64    `json:"GPSLatitude,omitempty"`       // Signed decimal degrees
+	GPSLongitude        *float64    `json:"GPSLongitude,omitempty"`      // Signed decimal degrees
+	GPSAltitude         *float64    `json:"GPSAltitude,omitempty"`       // Metres, negative below sea level
+	MediaCreateDate     string      `json:"MediaCreateDate,omitempty"`   // Videos: movie creation time, in UTC
+	Duration            float64     `json:"Duration,omitempty"`          // Videos: seconds
+	VideoCodec          string      `json:"VideoCodec,omitempty"`        // Videos: e.g. "h264", "hevc"
+	ContentIdentifier   string      `json:"ContentIdentifier,omitempty"` // Links a Live Photo's still and movie
+}
+
+// ScanAndImport scans the photos directory and imports new photos. EXIF
+// extraction and thumbnail generation run on a pool of workers (see
+// SetWorkers); progress can be followed with Progress.
 func (imp *Importer) ScanAndImport() error {
+	imp.mu.Lock()
+	if imp.progress.Running {
+		imp.mu.Unlock()
+		return fmt.Errorf("a scan is already running")
+	}
+	imp.progress = ImportProgress{
+		Running:   true,
+		Phase:     PhaseReconciling,
+		Workers:   imp.workers,
+		StartedAt: time.Now(),
+	}
+	imp.mu.Unlock()
+
+	defer imp.updateProgress(func(p *ImportProgress) {
+		p.Running = false
+		p.Phase = PhaseDone
+		p.FinishedAt = time.Now()
+	})
+
 	log.Printf("📂 Scanning photos directory: %s", imp.photosDir)
 
+	if err := imp.backfillTakenAt(); err != nil {
+		log.Printf("⚠️  Failed to backfill capture times: %v", err)
+	}
+	if err := imp.backfillContentHash(); err != nil {
+		log.Printf("⚠️  Failed to backfill content hashes: %v", err)
+	}
+	if err := imp.backfillPerceptualHash(); err != nil {
+		log.Printf("⚠️  Failed to backfill perceptual hashes: %v", err)
+	}
+	if err := imp.backfillLocation(); err != nil {
+		log.Printf("⚠️  Failed to backfill locations: %v", err)
+	}
+	if err := imp.backfillPlaces(); err != nil {
+		log.Printf("⚠️  Failed to backfill place names: %v", err)
+	}
+
+	// Relink moved files before the walk would import them as new photos
+	if _, err := imp.Reconcile(0); err != nil {
+		log.Printf("⚠️  Failed to reconcile library: %v", err)
+	}
+
 	// Get existing photos from database
 	existingPhotos, err := imp.db.GetPhotos()
 	if err != nil {
 		return fmt.Errorf("failed to get existing photos: %w", err)
 	}
 
-	// Create a map for quick lookup
+	// Create a map for quick lookup. Paths, not filenames, identify a photo:
+	// the same filename can appear in several folders.
 	existing := make(map[string]bool)
 	for _, photo := range existingPhotos {
-		existing[photo.Filename] = true
+		existing[photo.Path] = true
 	}
 
-	// Walk through photos directory
-	var newPhotos int
-	var thumbnailsGenerated int
+	// Walk through photos directory first, so the import knows its total
+	imp.updateProgress(func(p *ImportProgress) { p.Phase = PhaseScanning })
 
+	var queue []scannedFile
 	err = filepath.Walk(imp.photosDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -71,159 +214,240 @@ func (imp *Importer) ScanAndImport() error {
 		}
 
 		// Check if it's an image file
-		if !isImageFile(path) {
+		if !isMediaFile(path) {
 			return nil
 		}
 
-		filename := info.Name()
+		imp.updateProgress(func(p *ImportProgress) { p.Seen++ })
 
 		// Skip if already imported
-		if existing[filename] {
+		if existing[path] {
 			return nil
 		}
 
-		// Extract EXIF data
-		exifData, err := extractEXIF(path)
+		queue = append(queue, scannedFile{path: path, info: info})
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to walk directory: %w", err)
+	}
+
+	imp.updateProgress(func(p *ImportProgress) {
+		p.Phase = PhaseImporting
+		p.Queued = len(queue)
+		p.importStartedAt = time.Now()
+	})
+
+	duplicates := imp.importFiles(queue)
+
+	imp.groupCompanionFiles()
+	imp.syncFolders()
+
+	progress := imp.Progress()
+	log.Printf("\n✅ Import complete:")
+	log.Printf("   New photos: %d", progress.Imported)
+	log.Printf("   Thumbnails generated: %d", progress.Thumbnails)
+	if progress.Failed > 0 {
+		log.Printf("   Failed: %d", progress.Failed)
+	}
+	if duplicates > 0 {
+		log.Printf("   Exact duplicates found: %d (see /api/duplicates)", duplicates)
+	}
+
+	return nil
+}
+
+// readPhotoFile reads what the database stores about a photo file: its EXIF
+// metadata, content hash and capture time. Failures are logged and leave the
+// affected fields unset.
+func (imp *Importer) readPhotoFile(path string, info os.FileInfo) *db.Photo {
+	return imp.readPhotoFiles([]scannedFile{{path: path, info: info}})[0]
+}
+
+// readPhotoFiles is readPhotoFile for several files, reading their EXIF
+// metadata in a single exiftool round trip
+func (imp *Importer) readPhotoFiles(files []scannedFile) []*db.Photo {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.path
+	}
+	exif, err := imp.readEXIF(paths)
+
+	photos := make([]*db.Photo, len(files))
+	for i, f := range files {
+		filename := filepath.Base(f.path)
+		photo := &db.Photo{Path: f.path, Filename: filename, MediaType: db.MediaPhoto}
+
+		exifData := exif[f.path]
+		if exifData == nil && err == nil {
+			log.Printf("⚠️  Failed to extract EXIF from %s: no EXIF data found", filename)
+		}
+
+		// Hash the file so exact copies can be found regardless of name
+		hash, size, err := hashFile(f.path)
 		if err != nil {
-			log.Printf("⚠️  Failed to extract EXIF from %s: %v", filename, err)
+			log.Printf("⚠️  Failed to hash %s: %v", filename, err)
+		} else {
+			photo.ContentHash = sql.NullString{String: hash, Valid: true}
+			photo.FileSize = sql.NullInt64{Int64: size, Valid: true}
 		}
 
 		// Convert EXIF to JSON
-		var metadataJSON *string
 		if exifData != nil {
 			jsonBytes, err := json.Marshal(exifData)
 			if err == nil {
-				jsonStr := string(jsonBytes)
-				metadataJSON = &jsonStr
+				photo.MetadataJSON = sql.NullString{String: string(jsonBytes), Valid: true}
 			}
 		}
 
-		// Insert into database
-		photoID, err := imp.db.InsertPhoto(path, filename, metadataJSON)
-		if err != nil {
-			log.Printf("❌ Failed to import %s: %v", filename, err)
-			return nil
+		setLocation(photo, exifData)
+		imp.setPlace(photo)
+
+		if exifData != nil && exifData.ContentIdentifier != "" {
+			photo.ContentID = sql.NullString{String: exifData.ContentIdentifier, Valid: true}
 		}
 
-		newPhotos++
-		log.Printf("  📷 Imported: %s (ID: %d)", filename, photoID)
+		if isVideoFile(f.path) {
+			photo.MediaType = db.MediaVideo
+			if exifData != nil && exifData.Duration > 0 {
+				photo.Duration = sql.NullFloat64{Float64: exifData.Duration, Valid: true}
+			}
+			if exifData != nil && exifData.VideoCodec != "" {
+				photo.VideoCodec = sql.NullString{String: exifData.VideoCodec, Valid: true}
+			}
+		}
 
-		// Generate thumbnail
-		thumbPath := filepath.Join(imp.thumbsDir, fmt.Sprintf("%d.webp", photoID))
-		if err := GenerateThumbnail(path, thumbPath); err != nil {
-			log.Printf("⚠️  Failed to generate thumbnail for %s: %v", filename, err)
+		if ct, ok := DetermineCaptureTime(f.path, exifData, f.info); ok {
+			ct.apply(photo)
+		}
+
+		photos[i] = photo
+	}
+
+	return photos
+}
+
+// readEXIF reads the metadata of several files: images in a single exiftool
+// round trip, videos natively since exiftool reports QuickTime dates in UTC
+// without saying so. Failures are logged; err is only set when no image
+// could be read at all.
+func (imp *Importer) readEXIF(paths []string) (map[string]*EXIFData, error) {
+	var images, videos []string
+	for _, path := range paths {
+		if isVideoFile(path) {
+			videos = append(videos, path)
 		} else {
-			thumbnailsGenerated++
+			images = append(images, path)
 		}
+	}
 
-		return nil
-	})
+	exif := make(map[string]*EXIFData, len(paths))
+	var err error
+	if len(images) > 0 {
+		if exif, err = imp.exifReader().ReadEXIF(images...); err != nil {
+			log.Printf("⚠️  Failed to extract EXIF from %d files: %v", len(images), err)
+			exif = make(map[string]*EXIFData, len(paths))
+		}
+	}
+	if len(videos) > 0 {
+		movies, _ := NativeEXIFReader{}.ReadEXIF(videos...)
+		for path, data := range movies {
+			exif[path] = data
+		}
+	}
+	return exif, err
+}
 
+// insertPhoto adds a photo read by readPhotoFile to the database, setting its
+// ID, and generates its thumbnail. thumbnailed reports whether that worked.
+func (imp *Importer) insertPhoto(photo *db.Photo) (thumbnailed bool, err error) {
+	photo.ID, err = imp.db.InsertPhoto(photo)
 	if err != nil {
-		return fmt.Errorf("failed to walk directory: %w", err)
+		return false, err
 	}
 
-	log.Printf("\n✅ Import complete:")
-	log.Printf("   New photos: %d", newPhotos)
-	log.Printf("   Thumbnails generated: %d", thumbnailsGenerated)
+	log.Printf("  📷 Imported: %s (ID: %d)", photo.Filename, photo.ID)
 
-	return nil
+	return imp.generateThumbnail(photo), nil
 }
 
-// extractEXIF uses exiftool to extract EXIF data from a photo
-func extractEXIF(photoPath string) (*EXIFData, error) {
-	cmd := exec.Command("exiftool",
-		"-DateTimeOriginal",
-		"-CreateDate",
-		"-Make",
-		"-Model",
-		"-LensModel",
-		"-ISO",
-		"-FNumber",
-		"-ExposureTime",
-		"-FocalLength",
-		"-json",
-		photoPath,
-	)
-
-	output, err := cmd.Output()
+// groupCompanionFiles links files shown as one library item: Live Photo
+// movies to their stills and RAW files to their JPEGs. Returns the photos
+// just linked; failures are logged.
+func (imp *Importer) groupCompanionFiles() []db.Photo {
+	paired, err := imp.pairLivePhotos()
 	if err != nil {
-		return nil, err
+		log.Printf("⚠️  Failed to pair Live Photos: %v", err)
+	}
+	grouped, err := imp.groupRawFiles()
+	if err != nil {
+		log.Printf("⚠️  Failed to group RAW files: %v", err)
 	}
+	return append(paired, grouped...)
+}
 
-	// exiftool returns an array with one object
-	var result []EXIFData
-	if err := json.Unmarshal(output, &result); err != nil {
-		return nil, err
+// generateThumbnail (re)creates a photo's thumbnail and stores the
+// perceptual hash computed from it, logging failures
+func (imp *Importer) generateThumbnail(photo *db.Photo) bool {
+	hash, ok := imp.thumbnail(photo)
+	if hash != nil {
+		if err := imp.db.SetPerceptualHash(hash.PhotoID, hash.Hash); err != nil {
+			log.Printf("⚠️  Failed to store perceptual hash for %s: %v", photo.Filename, err)
+		}
 	}
+	return ok
+}
 
-	if len(result) == 0 {
-		return nil, fmt.Errorf("no EXIF data found")
+// thumbnail (re)creates a photo's thumbnail and computes its perceptual
+// hash without storing it. hash is nil when either step failed.
+func (imp *Importer) thumbnail(photo *db.Photo) (hash *db.PerceptualHash, ok bool) {
+	thumbPath := filepath.Join(imp.thumbsDir, fmt.Sprintf("%d.webp", photo.ID))
+	if err := generateThumbnail(imp.thumbs, photo.Path, thumbPath); err != nil {
+		log.Printf("⚠️  Failed to generate thumbnail for %s: %v", photo.Filename, err)
+		return nil, false
 	}
 
-	return &result[0], nil
+	h, err := perceptualHashFromThumbnail(thumbPath)
+	if err != nil {
+		log.Printf("⚠️  Failed to compute perceptual hash for %s: %v", photo.Filename, err)
+		return nil, true
+	}
+	return &db.PerceptualHash{PhotoID: photo.ID, Hash: h}, true
 }
 
-// GenerateThumbnail creates a 284px WebP thumbnail using vips or sips
-func GenerateThumbnail(sourcePath, destPath string) error {
-	// Ensure destination directory exists
-	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+// backfillTakenAt fills in the capture time of photos imported before it was
+// tracked, falling back to the import time when the file is gone
+func (imp *Importer) backfillTakenAt() error {
+	photos, err := imp.db.GetPhotosMissingTakenAt()
+	if err != nil {
 		return err
 	}
-
-	// Try vipsthumbnail first (fastest)
-	if err := generateWithVips(sourcePath, destPath); err == nil {
+	if len(photos) == 0 {
 		return nil
 	}
 
-	// Fallback to sips + cwebp (macOS)
-	return generateWithSips(sourcePath, destPath)
-}
-
-// generateWithVips uses vips thumbnail for fast WebP generation with auto-rotation
-func generateWithVips(sourcePath, destPath string) error {
-	// vips thumbnail auto-rotates based on EXIF orientation by default
-	// The [Q=85,strip] output options compress and strip EXIF after rotation
-	cmd := exec.Command("vips",
-		"thumbnail",
-		sourcePath,
-		fmt.Sprintf("%s[Q=85,strip]", destPath),
-		"284",
-	)
+	log.Printf("🕒 Backfilling capture time for %d photos...", len(photos))
 
-	return cmd.Run()
-}
+	for i := range photos {
+		photo := &photos[i]
 
-// generateWithSips uses macOS sips + cwebp as fallback
-func generateWithSips(sourcePath, destPath string) error {
-	// Create temp JPEG
-	tempJPG := destPath + ".tmp.jpg"
-	defer os.Remove(tempJPG)
+		var exifData *EXIFData
+		if photo.MetadataJSON.Valid {
+			var parsed EXIFData
+			if err := json.Unmarshal([]byte(photo.MetadataJSON.String), &parsed); err == nil {
+				exifData = &parsed
+			}
+		}
 
-	// Convert to JPEG with sips
-	cmd := exec.Command("sips",
-		"-s", "format", "jpeg",
-		"-Z", "284",
-		"--out", tempJPG,
-		sourcePath,
-	)
-	if err := cmd.Run(); err != nil {
-		return err
+		ct, ok := DetermineCaptureTime(photo.Path, exifData, nil)
+		if !ok {
+			ct = CaptureTime{Time: time.Unix(photo.ImportedAt, 0)}
+		}
+		ct.apply(photo)
 	}
 
-	// Auto-rotate
-	cmd = exec.Command("sips", "--rotate", "auto", tempJPG)
-	cmd.Run() // Ignore errors
-
-	// Convert to WebP
-	cmd = exec.Command("cwebp",
-		"-q", "85",
-		"-m", "4",
-		tempJPG,
-		"-o", destPath,
-	)
-
-	return cmd.Run()
+	return imp.db.SetTakenAt(photos)
 }
 
 // isImageFile checks if a file is a supported image format
@@ -233,9 +457,24 @@ func isImageFile(path string) bool {
 	case ".jpg", ".jpeg", ".png", ".heic", ".webp":
 		return true
 	}
+	return isRawFile(path)
+}
+
+// isVideoFile checks if a file is a supported video format
+func isVideoFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".mov", ".mp4", ".m4v":
+		return true
+	}
 	return false
 }
 
+// isMediaFile checks if a file is imported into the library
+func isMediaFile(path string) bool {
+	return isImageFile(path) || isVideoFile(path)
+}
+
 // ImportStats returns import statistics
 func (imp *Importer) ImportStats() (map[string]interface{}, error) {
 	photos, err := imp.db.GetPhotos()
@@ -0,0 +1,92 @@
+package importer
+
+import (
+	"database/sql"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/vieira/tidyphotos/internal/db"
+)
+
+// livePhotoMaxSkew bounds how far apart, in seconds, the capture times of a
+// still and movie paired by filename may be. The movie of a Live Photo
+// starts a moment before the shutter, and its date can be rounded
+// differently.
+const livePhotoMaxSkew = 3
+
+// pairLivePhotos links the stills of Apple Live Photos to their movies,
+// which listings then hide. A movie pairs with the still sharing its content
+// identifier or, failing that, with the still of the same name in the same
+// folder captured within livePhotoMaxSkew. Returns the stills just paired.
+func (imp *Importer) pairLivePhotos() ([]db.Photo, error) {
+	videos, err := imp.db.GetUnpairedVideos()
+	if err != nil {
+		return nil, err
+	}
+
+	var paired []db.Photo
+	used := make(map[int64]bool)
+	for i := range videos {
+		video := &videos[i]
+		candidates, err := imp.db.GetLivePhotoCandidates(video.ContentID.String, pathStem(video.Path))
+		if err != nil {
+			return nil, err
+		}
+
+		still := matchLiveStill(video, candidates, used)
+		if still == nil {
+			continue
+		}
+		used[still.ID] = true
+		still.LiveVideoID = sql.NullInt64{Int64: video.ID, Valid: true}
+		paired = append(paired, *still)
+	}
+
+	if len(paired) == 0 {
+		return nil, nil
+	}
+	if err := imp.db.SetLiveVideos(paired); err != nil {
+		return nil, err
+	}
+
+	log.Printf("🎞️  Paired %d Live Photos", len(paired))
+	return paired, nil
+}
+
+// matchLiveStill picks the still of a Live Photo movie among candidates,
+// skipping stills already paired in this run
+func matchLiveStill(video *db.Photo, candidates []db.Photo, used map[int64]bool) *db.Photo {
+	// A shared content identifier is conclusive
+	if video.ContentID.Valid {
+		for i := range candidates {
+			if c := &candidates[i]; !used[c.ID] && c.ContentID == video.ContentID {
+				return c
+			}
+		}
+	}
+
+	stem := pathStem(video.Path)
+	for i := range candidates {
+		c := &candidates[i]
+		if used[c.ID] || pathStem(c.Path) != stem {
+			continue
+		}
+		// Different identifiers are different captures, whatever the names
+		if c.ContentID.Valid && video.ContentID.Valid {
+			continue
+		}
+		if !c.TakenAt.Valid || !video.TakenAt.Valid {
+			continue
+		}
+		if skew := c.TakenAt.Int64 - video.TakenAt.Int64; skew >= -livePhotoMaxSkew && skew <= livePhotoMaxSkew {
+			return c
+		}
+	}
+	return nil
+}
+
+// pathStem returns path without its extension
+func pathStem(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
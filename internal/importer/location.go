@@ -0,0 +1,78 @@
+package importer
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+
+	"github.com/vieira/tidyphotos/internal/db"
+)
+
+// locationBatchSize bounds how many files one exiftool request re-reads
+// while backfilling locations
+const locationBatchSize = 100
+
+// setLocation copies the GPS position of a photo's EXIF to its location
+// columns, clearing them when there is none
+func setLocation(photo *db.Photo, exif *EXIFData) {
+	photo.Latitude, photo.Longitude, photo.Altitude = sql.NullFloat64{}, sql.NullFloat64{}, sql.NullFloat64{}
+	if exif == nil || exif.GPSLatitude == nil || exif.GPSLongitude == nil {
+		return
+	}
+	photo.Latitude = sql.NullFloat64{Float64: *exif.GPSLatitude, Valid: true}
+	photo.Longitude = sql.NullFloat64{Float64: *exif.GPSLongitude, Valid: true}
+	if exif.GPSAltitude != nil {
+		photo.Altitude = sql.NullFloat64{Float64: *exif.GPSAltitude, Valid: true}
+	}
+}
+
+// backfillLocation re-reads the EXIF of photos imported before GPS positions
+// were extracted, storing the metadata as now read along with the position.
+// Photos whose file can't be read keep their metadata. Either way each photo
+// is re-read once.
+func (imp *Importer) backfillLocation() error {
+	photos, err := imp.db.GetPhotosMissingLocation()
+	if err != nil {
+		return err
+	}
+	if len(photos) == 0 {
+		return nil
+	}
+
+	log.Printf("📍 Reading GPS positions of %d previously imported photos...", len(photos))
+
+	for start := 0; start < len(photos); start += locationBatchSize {
+		batch := photos[start:min(start+locationBatchSize, len(photos))]
+
+		paths := make([]string, len(batch))
+		for i, photo := range batch {
+			paths[i] = photo.Path
+		}
+		exif, err := imp.readEXIF(paths)
+		if err != nil {
+			return err
+		}
+
+		var located []db.Photo
+		for _, photo := range batch {
+			data := exif[photo.Path]
+			if data == nil {
+				located = append(located, photo)
+				continue
+			}
+			jsonBytes, err := json.Marshal(data)
+			if err != nil {
+				located = append(located, photo)
+				continue
+			}
+			photo.MetadataJSON = sql.NullString{String: string(jsonBytes), Valid: true}
+			setLocation(&photo, data)
+			located = append(located, photo)
+		}
+
+		if err := imp.db.SetLocations(located); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package importer
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/vieira/tidyphotos/internal/metadata"
+)
+
+// NativeEXIFReader is an EXIFReader built on the pure-Go metadata package.
+// It covers fewer formats and tags than exiftool but needs no external tools.
+type NativeEXIFReader struct{}
+
+// ReadEXIF implements EXIFReader
+func (NativeEXIFReader) ReadEXIF(paths ...string) (map[string]*EXIFData, error) {
+	result := make(map[string]*EXIFData, len(paths))
+	for _, path := range paths {
+		m, err := metadata.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		result[path] = exifDataFromMetadata(m)
+	}
+	return result, nil
+}
+
+// Close implements EXIFReader
+func (NativeEXIFReader) Close() error { return nil }
+
+// fallbackEXIFReader asks primary first and fallback for the files primary
+// could not read, or for every file when primary fails outright
+type fallbackEXIFReader struct {
+	primary  EXIFReader
+	fallback EXIFReader
+}
+
+func (r fallbackEXIFReader) ReadEXIF(paths ...string) (map[string]*EXIFData, error) {
+	result, err := r.primary.ReadEXIF(paths...)
+	if err != nil {
+		log.Printf("⚠️  exiftool failed, using built-in metadata reader: %v", err)
+		return r.fallback.ReadEXIF(paths...)
+	}
+
+	var missing []string
+	for _, path := range paths {
+		if result[path] == nil {
+			missing = append(missing, path)
+		}
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	extra, err := r.fallback.ReadEXIF(missing...)
+	if err != nil {
+		return result, nil
+	}
+	for path, data := range extra {
+		result[path] = data
+	}
+	return result, nil
+}
+
+func (r fallbackEXIFReader) Close() error {
+	return r.primary.Close()
+}
+
+// defaultEXIFReader uses exiftool with the native reader as a fallback, or
+// only the native reader when exiftool isn't installed
+func defaultEXIFReader(processes int) EXIFReader {
+	if _, err := exec.LookPath("exiftool"); err != nil {
+		log.Printf("ℹ️  exiftool not found, reading metadata with the built-in reader")
+		return NativeEXIFReader{}
+	}
+	return fallbackEXIFReader{primary: NewExifTool(processes), fallback: NativeEXIFReader{}}
+}
+
+// exifDataFromMetadata converts native metadata to EXIFData, formatting
+// values the way exiftool prints them so stored metadata looks the same
+// whichever reader produced it
+func exifDataFromMetadata(m *metadata.Metadata) *EXIFData {
+	data := &EXIFData{
+		DateTimeOriginal:    m.DateTimeOriginal,
+		CreateDate:          m.CreateDate,
+		OffsetTime:          m.OffsetTime,
+		OffsetTimeOriginal:  m.OffsetTimeOriginal,
+		OffsetTimeDigitized: m.OffsetTimeDigitized,
+		SubSecTimeOriginal:  m.SubSecTimeOriginal,
+		Make:                m.Make,
+		Model:               m.Model,
+		LensModel:           m.LensModel,
+		ISO:                 m.ISO,
+		Orientation:         m.Orientation,
+		ImageWidth:          m.Width,
+		ImageHeight:         m.Height,
+		MediaCreateDate:     m.MediaCreateDate,
+		Duration:            m.Duration,
+		VideoCodec:          m.VideoCodec,
+		ContentIdentifier:   m.ContentIdentifier,
+	}
+
+	if m.ExposureTime > 0 {
+		data.ExposureTime = formatExposureTime(m.ExposureTime)
+	}
+	if m.FNumber > 0 {
+		data.FNumber = math.Round(m.FNumber*10) / 10
+	}
+	if m.FocalLength > 0 {
+		data.FocalLength = fmt.Sprintf("%.1f mm", m.FocalLength)
+	}
+
+	if m.GPS != nil {
+		lat, lon := m.GPS.Latitude, m.GPS.Longitude
+		data.GPSLatitude, data.GPSLongitude = &lat, &lon
+		if m.GPS.Altitude != nil {
+			alt := *m.GPS.Altitude
+			data.GPSAltitude = &alt
+		}
+	}
+
+	return data
+}
+
+// formatExposureTime prints an exposure like exiftool: "1/250" for short
+// exposures, seconds otherwise
+func formatExposureTime(seconds float64) string {
+	if seconds < 0.25001 {
+		return fmt.Sprintf("1/%d", int(0.5+1/seconds))
+	}
+	s := strconv.FormatFloat(seconds, 'f', 1, 64)
+	return strings.TrimSuffix(s, ".0")
+}
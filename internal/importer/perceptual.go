@@ -0,0 +1,69 @@
+package importer
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg" // Thumbnail decoders
+	_ "image/png"
+	"log"
+	"os"
+	"path/filepath"
+
+	_ "golang.org/x/image/webp"
+
+	"github.com/vieira/tidyphotos/internal/phash"
+)
+
+// perceptualHashFromThumbnail computes the perceptual hash of a photo from
+// its already generated thumbnail, so the original is only decoded once
+func perceptualHashFromThumbnail(thumbPath string) (uint64, error) {
+	f, err := os.Open(thumbPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode thumbnail: %w", err)
+	}
+
+	return phash.DHash(img), nil
+}
+
+// storePerceptualHash hashes a photo's thumbnail and saves the result
+func (imp *Importer) storePerceptualHash(photoID int64, thumbPath string) error {
+	hash, err := perceptualHashFromThumbnail(thumbPath)
+	if err != nil {
+		return err
+	}
+	return imp.db.SetPerceptualHash(photoID, hash)
+}
+
+// backfillPerceptualHash hashes photos imported before perceptual hashes were
+// tracked. Photos without a thumbnail are skipped until one is generated.
+func (imp *Importer) backfillPerceptualHash() error {
+	photos, err := imp.db.GetPhotosMissingPerceptualHash()
+	if err != nil {
+		return err
+	}
+
+	hashed := 0
+	for _, photo := range photos {
+		thumbPath := filepath.Join(imp.thumbsDir, fmt.Sprintf("%d.webp", photo.ID))
+		if _, err := os.Stat(thumbPath); err != nil {
+			continue
+		}
+
+		if err := imp.storePerceptualHash(photo.ID, thumbPath); err != nil {
+			log.Printf("⚠️  Failed to compute perceptual hash for %s: %v", photo.Filename, err)
+			continue
+		}
+		hashed++
+	}
+
+	if hashed > 0 {
+		log.Printf("🧩 Computed perceptual hashes for %d previously imported photos", hashed)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package importer
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/vieira/tidyphotos/internal/db"
+	"github.com/vieira/tidyphotos/internal/geocode"
+)
+
+// SetGeocoder replaces the geocoder naming the places of located photos. The
+// default uses the gazetteer bundled with the binary.
+func (imp *Importer) SetGeocoder(g *geocode.Geocoder) {
+	imp.geocoder = g
+}
+
+// setPlace names the place of a photo's position, clearing the names when it
+// has none or the geocoder knows nothing near it. The gazetteer looked in is
+// recorded either way.
+func (imp *Importer) setPlace(photo *db.Photo) {
+	photo.Country, photo.Region, photo.City = sql.NullString{}, sql.NullString{}, sql.NullString{}
+	photo.PlaceSource = sql.NullString{}
+	if !photo.Latitude.Valid || !photo.Longitude.Valid {
+		return
+	}
+	photo.PlaceSource = sql.NullString{String: imp.geocoder.Version(), Valid: true}
+
+	place, ok := imp.geocoder.Lookup(photo.Latitude.Float64, photo.Longitude.Float64)
+	if !ok {
+		return
+	}
+	photo.Country = sql.NullString{String: place.Country, Valid: true}
+	photo.Region = sql.NullString{String: place.Region, Valid: place.Region != ""}
+	photo.City = sql.NullString{String: place.City, Valid: place.City != ""}
+}
+
+// backfillPlaces names the places of located photos imported before places
+// were named, and renames those named with another gazetteer, e.g. after
+// GEONAMES_DIR is set
+func (imp *Importer) backfillPlaces() error {
+	photos, err := imp.db.GetPhotosMissingPlace(imp.geocoder.Version())
+	if err != nil {
+		return err
+	}
+	if len(photos) == 0 {
+		return nil
+	}
+
+	named := 0
+	for i := range photos {
+		imp.setPlace(&photos[i])
+		if photos[i].Country.Valid {
+			named++
+		}
+	}
+
+	if err := imp.db.SetPlaces(photos); err != nil {
+		return err
+	}
+	log.Printf("🗺️  Looked up the places of %d photos, %d named", len(photos), named)
+	return nil
+}
@@ -0,0 +1,186 @@
+package importer
+
+import (
+	"log"
+	"os"
+	"sync"
+
+	"github.com/vieira/tidyphotos/internal/db"
+)
+
+const (
+	// importBatchSize is how many rows are written per database transaction
+	importBatchSize = 100
+
+	// exifBatchSize is how many files a worker reads per exiftool round trip
+	exifBatchSize = 16
+)
+
+// scannedFile is a new image file found by the directory walk
+type scannedFile struct {
+	path string
+	info os.FileInfo
+}
+
+// importFiles imports new files through a pipeline: a pool of workers reads
+// EXIF in batches and hashes the files, a single writer inserts the rows in
+// batched transactions, and a second pool generates thumbnails whose
+// perceptual hashes are again written in batches. Returns the number of
+// exact duplicates found.
+func (imp *Importer) importFiles(files []scannedFile) (duplicates int) {
+	if len(files) == 0 {
+		return 0
+	}
+
+	queue := make(chan []scannedFile)
+	read := make(chan *db.Photo, imp.workers*exifBatchSize)
+	inserted := make(chan *db.Photo, importBatchSize)
+	hashes := make(chan db.PerceptualHash, importBatchSize)
+
+	go func() {
+		for start := 0; start < len(files); start += exifBatchSize {
+			queue <- files[start:min(start+exifBatchSize, len(files))]
+		}
+		close(queue)
+	}()
+
+	var readers sync.WaitGroup
+	for range imp.workers {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for chunk := range queue {
+				for _, photo := range imp.readPhotoFiles(chunk) {
+					read <- photo
+				}
+			}
+		}()
+	}
+	go func() {
+		readers.Wait()
+		close(read)
+	}()
+
+	var thumbnailers sync.WaitGroup
+	for range imp.workers {
+		thumbnailers.Add(1)
+		go func() {
+			defer thumbnailers.Done()
+			for photo := range inserted {
+				hash, ok := imp.thumbnail(photo)
+				imp.updateProgress(func(p *ImportProgress) {
+					if ok {
+						p.Thumbnails++
+					} else {
+						p.ThumbnailsFailed++
+					}
+				})
+				if hash != nil {
+					hashes <- *hash
+				}
+			}
+		}()
+	}
+	go func() {
+		thumbnailers.Wait()
+		close(hashes)
+	}()
+
+	hashesDone := make(chan struct{})
+	go func() {
+		defer close(hashesDone)
+		imp.writePerceptualHashes(hashes)
+	}()
+
+	// Hashes of files earlier in this scan, which are not in the database
+	// until their batch is written
+	seen := make(map[string]string)
+
+	var batch []*db.Photo
+	flush := func() {
+		for _, photo := range imp.insertBatch(batch) {
+			inserted <- photo
+		}
+		batch = nil
+	}
+
+	for photo := range read {
+		if photo.ContentHash.Valid {
+			hash := photo.ContentHash.String
+			if path, ok := seen[hash]; ok {
+				duplicates++
+				log.Printf("  🪞 %s is a duplicate of %s", photo.Path, path)
+			} else if copies, err := imp.db.GetPhotosByContentHash(hash); err == nil && len(copies) > 0 {
+				duplicates++
+				log.Printf("  🪞 %s is a duplicate of %s (ID: %d)", photo.Path, copies[0].Path, copies[0].ID)
+			} else {
+				seen[hash] = photo.Path
+			}
+		}
+
+		batch = append(batch, photo)
+		if len(batch) >= importBatchSize {
+			flush()
+		}
+	}
+	flush()
+	close(inserted)
+
+	<-hashesDone
+	return duplicates
+}
+
+// insertBatch writes a batch of photos in one transaction. If the batch
+// fails, its photos are retried one by one so a single bad file doesn't
+// lose the rest. Returns the photos that were inserted.
+func (imp *Importer) insertBatch(batch []*db.Photo) []*db.Photo {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if err := imp.db.InsertPhotos(batch); err == nil {
+		for _, photo := range batch {
+			log.Printf("  📷 Imported: %s (ID: %d)", photo.Filename, photo.ID)
+		}
+		imp.updateProgress(func(p *ImportProgress) { p.Imported += len(batch) })
+		return batch
+	}
+
+	var inserted []*db.Photo
+	for _, photo := range batch {
+		id, err := imp.db.InsertPhoto(photo)
+		if err != nil {
+			log.Printf("❌ Failed to import %s: %v", photo.Filename, err)
+			imp.updateProgress(func(p *ImportProgress) { p.Failed++ })
+			continue
+		}
+		photo.ID = id
+		log.Printf("  📷 Imported: %s (ID: %d)", photo.Filename, photo.ID)
+		imp.updateProgress(func(p *ImportProgress) { p.Imported++ })
+		inserted = append(inserted, photo)
+	}
+	return inserted
+}
+
+// writePerceptualHashes stores hashes from the thumbnail workers in batches
+// until the channel is closed
+func (imp *Importer) writePerceptualHashes(hashes <-chan db.PerceptualHash) {
+	var batch []db.PerceptualHash
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := imp.db.SetPerceptualHashes(batch); err != nil {
+			log.Printf("⚠️  Failed to store %d perceptual hashes: %v", len(batch), err)
+		}
+		batch = nil
+	}
+
+	for hash := range hashes {
+		batch = append(batch, hash)
+		if len(batch) >= importBatchSize {
+			flush()
+		}
+	}
+	flush()
+}
@@ -0,0 +1,66 @@
+package importer
+
+import (
+	"time"
+)
+
+// Phases of a scan, in order
+const (
+	PhaseIdle        = "idle"
+	PhaseReconciling = "reconciling" // Backfills and Reconcile
+	PhaseScanning    = "scanning"    // Walking the photos directory
+	PhaseImporting   = "importing"   // Reading, inserting and thumbnailing new files
+	PhaseDone        = "done"
+)
+
+// ImportProgress is a snapshot of the current or most recent scan
+type ImportProgress struct {
+	Running          bool      `json:"running"`
+	Phase            string    `json:"phase"`
+	Seen             int       `json:"seen"`   // Image files found in the photos directory
+	Queued           int       `json:"queued"` // New files among them, to be imported
+	Imported         int       `json:"imported"`
+	Failed           int       `json:"failed"`
+	Thumbnails       int       `json:"thumbnails"`
+	ThumbnailsFailed int       `json:"thumbnails_failed"`
+	Workers          int       `json:"workers"`
+	StartedAt        time.Time `json:"started_at"`
+	FinishedAt       time.Time `json:"finished_at,omitzero"`
+	// ETASeconds estimates the time left from the import rate so far. It is
+	// nil until the first file has been processed.
+	ETASeconds *float64 `json:"eta_seconds"`
+
+	importStartedAt time.Time // Start of PhaseImporting, for the ETA
+}
+
+// Progress returns a snapshot of the current or most recent scan
+func (imp *Importer) Progress() ImportProgress {
+	imp.mu.Lock()
+	p := imp.progress
+	imp.mu.Unlock()
+
+	if p.Phase == "" {
+		p.Phase = PhaseIdle
+	}
+
+	// A file counts as done once its thumbnail has been attempted
+	done := p.Failed + p.Thumbnails + p.ThumbnailsFailed
+	if p.Phase == PhaseImporting && done > 0 {
+		perFile := time.Since(p.importStartedAt).Seconds() / float64(done)
+		eta := perFile * float64(p.Queued-done)
+		p.ETASeconds = &eta
+	}
+	if p.Phase == PhaseDone {
+		eta := 0.0
+		p.ETASeconds = &eta
+	}
+
+	return p
+}
+
+// updateProgress applies fn to the progress under the lock
+func (imp *Importer) updateProgress(fn func(p *ImportProgress)) {
+	imp.mu.Lock()
+	fn(&imp.progress)
+	imp.mu.Unlock()
+}
@@ -0,0 +1,68 @@
+package importer
+
+import (
+	"database/sql"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/vieira/tidyphotos/internal/db"
+)
+
+// rawExtensions are the camera RAW formats imported, read through their
+// embedded JPEG previews
+var rawExtensions = []string{".cr2", ".nef", ".arw", ".dng", ".raf"}
+
+// isRawFile checks if a file is a supported camera RAW format
+func isRawFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, raw := range rawExtensions {
+		if ext == raw {
+			return true
+		}
+	}
+	return false
+}
+
+// groupRawFiles groups RAW files with the JPEG shot alongside them: the
+// image of the same name in the same folder. The JPEG then stands for both
+// in listings, with the RAW as a second original. Returns the JPEGs just
+// grouped.
+func (imp *Importer) groupRawFiles() ([]db.Photo, error) {
+	raws, err := imp.db.GetUngroupedRawFiles(rawExtensions)
+	if err != nil {
+		return nil, err
+	}
+
+	var grouped []db.Photo
+	used := make(map[int64]bool)
+	for _, raw := range raws {
+		stem := pathStem(raw.Path)
+		candidates, err := imp.db.GetPhotosByStem(stem)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range candidates {
+			// RAW files never group with each other, e.g. a CR2 and its
+			// DNG conversion
+			if used[c.ID] || pathStem(c.Path) != stem || isRawFile(c.Path) {
+				continue
+			}
+			used[c.ID] = true
+			c.RawID = sql.NullInt64{Int64: raw.ID, Valid: true}
+			grouped = append(grouped, c)
+			break
+		}
+	}
+
+	if len(grouped) == 0 {
+		return nil, nil
+	}
+	if err := imp.db.SetRawFiles(grouped); err != nil {
+		return nil, err
+	}
+
+	log.Printf("🗂️  Grouped %d RAW+JPEG pairs", len(grouped))
+	return grouped, nil
+}
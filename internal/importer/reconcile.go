@@ -0,0 +1,217 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vieira/tidyphotos/internal/db"
+)
+
+// ReconcileStats counts what Reconcile changed
+type ReconcileStats struct {
+	Missing          int // Photos newly flagged missing
+	Restored         int // Flagged photos whose file is back at its path
+	Relinked         int // Missing photos found at a new path
+	Pruned           int // Photos removed after their grace period
+	ThumbnailsPurged int // Thumbnails, renditions and transcodes without a photo row
+}
+
+// Reconcile checks the database against the photos directory. Photos whose
+// file is gone are flagged missing, flagged photos whose file is back are
+// restored, and missing photos whose content turns up under another path are
+// relinked to it. With pruneAfter > 0, photos missing for longer than that
+// are deleted. Finally, thumbnails that no longer belong to a photo are
+// removed. New files are left for ScanAndImport.
+func (imp *Importer) Reconcile(pruneAfter time.Duration) (ReconcileStats, error) {
+	var stats ReconcileStats
+
+	photos, err := imp.db.GetPhotos()
+	if err != nil {
+		return stats, fmt.Errorf("failed to get photos: %w", err)
+	}
+
+	known := make(map[string]bool, len(photos))
+	for _, photo := range photos {
+		known[photo.Path] = true
+
+		_, err := os.Stat(photo.Path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && !photo.MissingSince.Valid:
+			if _, err := imp.db.MarkPhotosMissing(photo.Path); err != nil {
+				return stats, fmt.Errorf("failed to flag %s missing: %w", photo.Path, err)
+			}
+			stats.Missing++
+		case err == nil && photo.MissingSince.Valid:
+			if err := imp.db.RelinkPhoto(photo.ID, photo.Path, photo.Filename); err != nil {
+				return stats, fmt.Errorf("failed to restore %s: %w", photo.Path, err)
+			}
+			stats.Restored++
+		}
+	}
+
+	if stats.Relinked, err = imp.relinkMoved(known); err != nil {
+		return stats, err
+	}
+
+	if pruneAfter > 0 {
+		pruned, err := imp.db.PruneMissingPhotos(time.Now().Add(-pruneAfter).Unix())
+		if err != nil {
+			return stats, fmt.Errorf("failed to prune missing photos: %w", err)
+		}
+		stats.Pruned = len(pruned)
+	}
+
+	if stats.ThumbnailsPurged, err = imp.purgeOrphanThumbnails(); err != nil {
+		return stats, err
+	}
+
+	if stats != (ReconcileStats{}) {
+		log.Printf("🔗 Reconciled library: %d missing, %d restored, %d relinked, %d pruned, %d orphan thumbnails removed",
+			stats.Missing, stats.Restored, stats.Relinked, stats.Pruned, stats.ThumbnailsPurged)
+	}
+	return stats, nil
+}
+
+// relinkMoved looks for the files of missing photos among the image files
+// not yet in the database. Only files whose size matches a missing photo
+// are hashed.
+func (imp *Importer) relinkMoved(known map[string]bool) (int, error) {
+	missing, err := imp.db.GetMissingPhotos()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get missing photos: %w", err)
+	}
+
+	bySize := make(map[int64][]db.Photo)
+	for _, photo := range missing {
+		if photo.ContentHash.Valid && photo.FileSize.Valid {
+			bySize[photo.FileSize.Int64] = append(bySize[photo.FileSize.Int64], photo)
+		}
+	}
+	if len(bySize) == 0 {
+		return 0, nil
+	}
+
+	relinked := 0
+	err = filepath.Walk(imp.photosDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isMediaFile(path) || known[path] {
+			return nil
+		}
+
+		candidates := bySize[info.Size()]
+		if len(candidates) == 0 {
+			return nil
+		}
+
+		hash, _, err := hashFile(path)
+		if err != nil {
+			log.Printf("⚠️  Failed to hash %s: %v", path, err)
+			return nil
+		}
+
+		for i, photo := range candidates {
+			if photo.ContentHash.String != hash {
+				continue
+			}
+			if err := imp.db.RelinkPhoto(photo.ID, path, info.Name()); err != nil {
+				return fmt.Errorf("failed to relink %s: %w", path, err)
+			}
+			log.Printf("  🚚 Moved: %s -> %s (ID: %d)", photo.Path, path, photo.ID)
+			relinked++
+			known[path] = true
+
+			// Each missing photo claims one file; further copies are imported
+			bySize[info.Size()] = append(candidates[:i:i], candidates[i+1:]...)
+			break
+		}
+		return nil
+	})
+	if err != nil {
+		return relinked, fmt.Errorf("failed to walk directory: %w", err)
+	}
+	return relinked, nil
+}
+
+// purgeOrphanThumbnails deletes {id}.webp thumbnails, renditions/{id}
+// directories and transcodes/{id}-* files whose photo is no longer in the
+// database
+func (imp *Importer) purgeOrphanThumbnails() (int, error) {
+	photos, err := imp.db.GetPhotos()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get photos: %w", err)
+	}
+	ids := make(map[int64]bool, len(photos))
+	for _, photo := range photos {
+		ids[photo.ID] = true
+	}
+
+	entries, err := os.ReadDir(imp.thumbsDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, fmt.Errorf("failed to read thumbnails: %w", err)
+	}
+
+	purged := 0
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".webp")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		id, err := strconv.ParseInt(name, 10, 64)
+		if err != nil || ids[id] {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(imp.thumbsDir, entry.Name())); err != nil {
+			log.Printf("⚠️  Failed to remove orphan thumbnail %s: %v", entry.Name(), err)
+			continue
+		}
+		purged++
+	}
+
+	entries, err = os.ReadDir(imp.renditionsDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return purged, fmt.Errorf("failed to read renditions: %w", err)
+	}
+
+	for _, entry := range entries {
+		id, err := strconv.ParseInt(entry.Name(), 10, 64)
+		if err != nil || !entry.IsDir() || ids[id] {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(imp.renditionsDir, entry.Name())); err != nil {
+			log.Printf("⚠️  Failed to remove orphan renditions %s: %v", entry.Name(), err)
+			continue
+		}
+		purged++
+	}
+
+	entries, err = os.ReadDir(imp.transcodesDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return purged, fmt.Errorf("failed to read transcodes: %w", err)
+	}
+
+	for _, entry := range entries {
+		prefix, _, _ := strings.Cut(entry.Name(), "-")
+		id, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil || entry.IsDir() || ids[id] {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(imp.transcodesDir, entry.Name())); err != nil {
+			log.Printf("⚠️  Failed to remove orphan transcode %s: %v", entry.Name(), err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
@@ -0,0 +1,148 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/vieira/tidyphotos/internal/db"
+)
+
+// renditionSizes bounds the longer side of each named rendition, in pixels
+var renditionSizes = map[string]int{
+	"grid":      ThumbnailSize,
+	"grid2x":    2 * ThumbnailSize,
+	"preview":   1600,
+	"preview2x": 3200,
+}
+
+// ErrUnknownRendition is returned for rendition names not in renditionSizes
+var ErrUnknownRendition = errors.New("unknown rendition")
+
+// Rendition returns a photo scaled to the named rendition size, encoded in
+// the first of formats the thumbnail generator can write. Renditions are
+// generated on first use and cached under cache/renditions/{id}, keyed by
+// the photo's content hash so edited files are rendered again.
+func (imp *Importer) Rendition(photo *db.Photo, name string, formats []ImageFormat) (string, ImageFormat, error) {
+	size, ok := renditionSizes[name]
+	if !ok {
+		return "", "", ErrUnknownRendition
+	}
+
+	dir := filepath.Join(imp.renditionsDir, strconv.FormatInt(photo.ID, 10))
+	base := name + "-" + renditionVersion(photo)
+
+	// The grid thumbnail generated on import doubles as the grid rendition
+	if name == "grid" {
+		thumbPath := filepath.Join(imp.thumbsDir, fmt.Sprintf("%d.webp", photo.ID))
+		if format, err := sniffImageFormat(thumbPath); err == nil && containsFormat(formats, format) {
+			return thumbPath, format, nil
+		}
+	}
+
+	path, format, _, err := imp.render(photo, dir, name, base, size, formats)
+	return path, format, err
+}
+
+// render returns dir/base in the first of formats that is already cached
+// or can be generated at size. generated reports whether it was just
+// written; other versions of the photo under dir/prefix-* are then removed.
+func (imp *Importer) render(photo *db.Photo, dir, prefix, base string, size int, formats []ImageFormat) (path string, format ImageFormat, generated bool, err error) {
+	// Requests for a rendition being generated wait for it rather than
+	// rendering the same photo twice
+	key := filepath.Join(dir, base)
+	for {
+		if path, format, ok := cachedRendition(dir, base, formats); ok {
+			return path, format, false, nil
+		}
+
+		imp.renderMu.Lock()
+		wait, busy := imp.rendering[key]
+		if !busy {
+			imp.rendering[key] = make(chan struct{})
+		}
+		imp.renderMu.Unlock()
+
+		if !busy {
+			break
+		}
+		<-wait
+	}
+	defer func() {
+		imp.renderMu.Lock()
+		close(imp.rendering[key])
+		delete(imp.rendering, key)
+		imp.renderMu.Unlock()
+	}()
+
+	// Large originals take a lot of memory to decode; bound how many are
+	// rendered at once
+	imp.renderSem <- struct{}{}
+	defer func() { <-imp.renderSem }()
+
+	for _, format := range formats {
+		path := filepath.Join(dir, base+format.Extension())
+		err = writeThumbnail(imp.thumbs, photo.Path, path, size, format)
+		if err == nil {
+			removeStaleRenditions(dir, prefix, base)
+			return path, format, true, nil
+		}
+		if !errors.Is(err, ErrUnsupportedFormat) {
+			break
+		}
+	}
+	if err == nil {
+		err = errors.New("no acceptable format")
+	}
+	return "", "", false, err
+}
+
+// renditionVersion identifies the content a rendition was generated from
+func renditionVersion(photo *db.Photo) string {
+	if photo.ContentHash.Valid && len(photo.ContentHash.String) >= 8 {
+		return photo.ContentHash.String[:8]
+	}
+	return "0"
+}
+
+// cachedRendition finds an already generated rendition in one of formats
+func cachedRendition(dir, base string, formats []ImageFormat) (string, ImageFormat, bool) {
+	for _, format := range formats {
+		path := filepath.Join(dir, base+format.Extension())
+		if _, err := os.Stat(path); err == nil {
+			return path, format, true
+		}
+	}
+	return "", "", false
+}
+
+// removeStaleRenditions deletes the files under dir/prefix-* generated from
+// an earlier version of the photo than base
+func removeStaleRenditions(dir, prefix, base string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		file := entry.Name()
+		if !strings.HasPrefix(file, prefix+"-") || strings.HasPrefix(file, base+".") {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, file)); err != nil {
+			log.Printf("⚠️  Failed to remove stale rendition %s: %v", file, err)
+		}
+	}
+}
+
+func containsFormat(formats []ImageFormat, format ImageFormat) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
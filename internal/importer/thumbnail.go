@@ -0,0 +1,477 @@
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/draw"
+
+	"github.com/vieira/tidyphotos/internal/metadata"
+)
+
+// ThumbnailSize bounds the longer side of a thumbnail, in pixels
+const ThumbnailSize = 284
+
+// ImageFormat is an output format thumbnails and renditions can be encoded in
+type ImageFormat string
+
+const (
+	FormatJPEG ImageFormat = "jpeg"
+	FormatWebP ImageFormat = "webp"
+	FormatAVIF ImageFormat = "avif"
+)
+
+// Extension returns the file extension of the format, including the dot
+func (f ImageFormat) Extension() string {
+	if f == FormatJPEG {
+		return ".jpg"
+	}
+	return "." + string(f)
+}
+
+// ContentType returns the MIME type of the format
+func (f ImageFormat) ContentType() string {
+	return "image/" + string(f)
+}
+
+// ErrUnsupportedFormat is returned by generators that cannot encode the
+// requested format
+var ErrUnsupportedFormat = errors.New("unsupported output format")
+
+// thumbnailFormats are the formats grid thumbnails are written in, in order
+// of preference. Every generator can write at least one of them.
+var thumbnailFormats = []ImageFormat{FormatWebP, FormatJPEG}
+
+// ThumbnailGenerator writes the photo at sourcePath to destPath, rotated
+// upright, scaled down to fit within size pixels and encoded as format. A
+// size of 0 keeps the photo's dimensions. The destination directory already
+// exists.
+type ThumbnailGenerator interface {
+	Generate(sourcePath, destPath string, size int, format ImageFormat) error
+}
+
+// DefaultThumbnailGenerator prefers the external tools, which handle more
+// formats and produce smaller files, and falls back to the built-in
+// generator when neither is installed or they fail
+var DefaultThumbnailGenerator ThumbnailGenerator = FallbackThumbnailer{
+	VipsThumbnailer{},
+	SipsThumbnailer{},
+	NativeThumbnailer{},
+}
+
+// ThumbnailGeneratorByName returns the generator configured by name: "vips",
+// "sips", "native", or "auto" (or empty) for the default
+func ThumbnailGeneratorByName(name string) (ThumbnailGenerator, error) {
+	switch name {
+	case "", "auto":
+		return DefaultThumbnailGenerator, nil
+	case "vips":
+		return VipsThumbnailer{}, nil
+	case "sips":
+		return SipsThumbnailer{}, nil
+	case "native":
+		return NativeThumbnailer{}, nil
+	}
+	return nil, fmt.Errorf("unknown thumbnail generator %q (want auto, vips, sips or native)", name)
+}
+
+// GenerateThumbnail creates a 284px thumbnail with the default generator
+func GenerateThumbnail(sourcePath, destPath string) error {
+	return generateThumbnail(DefaultThumbnailGenerator, sourcePath, destPath)
+}
+
+// generateThumbnail writes a grid thumbnail in the first of thumbnailFormats
+// g supports. Thumbnails keep their .webp name whatever the format, and are
+// served with a sniffed content type.
+func generateThumbnail(g ThumbnailGenerator, sourcePath, destPath string) error {
+	var err error
+	for _, format := range thumbnailFormats {
+		err = writeThumbnail(g, sourcePath, destPath, ThumbnailSize, format)
+		if !errors.Is(err, ErrUnsupportedFormat) {
+			return err
+		}
+	}
+	return err
+}
+
+// writeThumbnail runs g into a temporary file next to destPath and renames
+// it into place, so a file being served is never seen half written. Videos
+// and RAW files go through a VideoThumbnailer or RawThumbnailer wrapping g.
+func writeThumbnail(g ThumbnailGenerator, sourcePath, destPath string, size int, format ImageFormat) error {
+	switch {
+	case isVideoFile(sourcePath):
+		g = VideoThumbnailer{Images: g}
+	case isRawFile(sourcePath):
+		g = RawThumbnailer{Images: g}
+	}
+
+	dir := filepath.Dir(destPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// The extension tells vips which format to write
+	tmp, err := os.CreateTemp(dir, ".tmp-*"+format.Extension())
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := g.Generate(sourcePath, tmp.Name(), size, format); err != nil {
+		return err
+	}
+	// CreateTemp makes files private to the owner
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), destPath)
+}
+
+// sniffImageFormat reports the format of an image file from its signature
+func sniffImageFormat(path string) (ImageFormat, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return "", err
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte{0xff, 0xd8, 0xff}):
+		return FormatJPEG, nil
+	case string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return FormatWebP, nil
+	case string(head[4:12]) == "ftypavif":
+		return FormatAVIF, nil
+	}
+	return "", fmt.Errorf("%s: unknown image format", path)
+}
+
+// FallbackThumbnailer tries each generator in turn until one succeeds
+type FallbackThumbnailer []ThumbnailGenerator
+
+// Generate implements ThumbnailGenerator
+func (f FallbackThumbnailer) Generate(sourcePath, destPath string, size int, format ImageFormat) error {
+	var errs generatorErrors
+	for _, g := range f {
+		err := g.Generate(sourcePath, destPath, size, format)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return errors.New("no thumbnail generator configured")
+	}
+	return errs
+}
+
+// generatorErrors collects the failures of a FallbackThumbnailer on one line
+type generatorErrors []error
+
+func (e generatorErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e generatorErrors) Unwrap() []error { return e }
+
+// VipsThumbnailer uses vips thumbnail, which writes every ImageFormat
+type VipsThumbnailer struct{}
+
+// vipsMaxSize is larger than any photo's side
+const vipsMaxSize = 100_000
+
+// Generate implements ThumbnailGenerator
+func (VipsThumbnailer) Generate(sourcePath, destPath string, size int, format ImageFormat) error {
+	// AVIF reaches the same visual quality as JPEG and WebP at a lower Q
+	quality := 85
+	if format == FormatAVIF {
+		quality = 60
+	}
+
+	// vips thumbnail auto-rotates based on EXIF orientation by default
+	// The [Q=85,strip] output options compress and strip EXIF after rotation
+	// The output format follows the extension of destPath
+	// --size down never enlarges, so a huge bound keeps the dimensions
+	if size == 0 {
+		size = vipsMaxSize
+	}
+
+	cmd := exec.Command("vips",
+		"thumbnail",
+		sourcePath,
+		fmt.Sprintf("%s[Q=%d,strip]", destPath, quality),
+		fmt.Sprint(size),
+		"--size", "down",
+	)
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("vips: %w", err)
+	}
+	return nil
+}
+
+// SipsThumbnailer uses macOS sips, plus cwebp for WebP
+type SipsThumbnailer struct{}
+
+// Generate implements ThumbnailGenerator
+func (SipsThumbnailer) Generate(sourcePath, destPath string, size int, format ImageFormat) error {
+	jpegPath := destPath
+	switch format {
+	case FormatJPEG:
+	case FormatWebP:
+		// Create temp JPEG
+		jpegPath = destPath + ".tmp.jpg"
+		defer os.Remove(jpegPath)
+	default:
+		return fmt.Errorf("sips: %w %s", ErrUnsupportedFormat, format)
+	}
+
+	// Convert to JPEG with sips
+	args := []string{"-s", "format", "jpeg"}
+	if size > 0 {
+		args = append(args, "-Z", fmt.Sprint(size))
+	}
+	args = append(args, "--out", jpegPath, sourcePath)
+	cmd := exec.Command("sips", args...)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sips: %w", err)
+	}
+
+	// Auto-rotate
+	cmd = exec.Command("sips", "--rotate", "auto", jpegPath)
+	cmd.Run() // Ignore errors
+
+	if format == FormatJPEG {
+		return nil
+	}
+
+	// Convert to WebP
+	cmd = exec.Command("cwebp",
+		"-q", "85",
+		"-m", "4",
+		jpegPath,
+		"-o", destPath,
+	)
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cwebp: %w", err)
+	}
+	return nil
+}
+
+// VideoThumbnailer makes thumbnails of videos from a poster frame extracted
+// with ffmpeg, which Images then scales and encodes
+type VideoThumbnailer struct {
+	Images ThumbnailGenerator
+}
+
+// posterFrameOffset is how far into a video, in seconds, the poster frame is
+// taken, past fade-ins and the blur of the first frames
+const posterFrameOffset = "1"
+
+// Generate implements ThumbnailGenerator
+func (v VideoThumbnailer) Generate(sourcePath, destPath string, size int, format ImageFormat) error {
+	frame := destPath + ".frame.jpg"
+	defer os.Remove(frame)
+
+	if err := extractPosterFrame(sourcePath, frame); err != nil {
+		return err
+	}
+	return v.Images.Generate(frame, destPath, size, format)
+}
+
+// extractPosterFrame writes one full-size frame of a video as JPEG. ffmpeg
+// applies the rotation phones record, so the frame is upright.
+func extractPosterFrame(sourcePath, destPath string) error {
+	var err error
+	// Clips shorter than the offset yield no frame; retry from the start
+	for _, offset := range []string{posterFrameOffset, "0"} {
+		cmd := exec.Command("ffmpeg",
+			"-v", "error",
+			"-y",
+			"-ss", offset,
+			"-i", sourcePath,
+			"-frames:v", "1",
+			"-q:v", "2",
+			destPath,
+		)
+		if err = cmd.Run(); err != nil {
+			err = fmt.Errorf("ffmpeg: %w", err)
+			continue
+		}
+		if info, statErr := os.Stat(destPath); statErr == nil && info.Size() > 0 {
+			return nil
+		}
+		err = errors.New("ffmpeg: no frame extracted")
+	}
+	return err
+}
+
+// RawThumbnailer makes thumbnails of camera RAW files from the JPEG preview
+// the camera embedded, which Images then scales and encodes. Developing the
+// RAW data itself would be slower and look less like what the photographer
+// saw on the camera.
+type RawThumbnailer struct {
+	Images ThumbnailGenerator
+}
+
+// Generate implements ThumbnailGenerator
+func (t RawThumbnailer) Generate(sourcePath, destPath string, size int, format ImageFormat) error {
+	data, err := metadata.ReadPreviewFile(sourcePath)
+	if err != nil {
+		return fmt.Errorf("raw preview: %w", err)
+	}
+
+	preview := destPath + ".preview.jpg"
+	defer os.Remove(preview)
+	if err := os.WriteFile(preview, data, 0644); err != nil {
+		return err
+	}
+	return t.Images.Generate(preview, destPath, size, format)
+}
+
+// maxNativePixels guards the built-in generator against images that would
+// need gigabytes of memory to decode
+const maxNativePixels = 100_000_000
+
+// NativeThumbnailer is a pure-Go generator for JPEG, PNG and WebP photos.
+// It only writes JPEG, since Go has no WebP or AVIF encoder.
+type NativeThumbnailer struct {
+	Quality int // JPEG quality; 85 when zero
+}
+
+// Generate implements ThumbnailGenerator
+func (n NativeThumbnailer) Generate(sourcePath, destPath string, size int, format ImageFormat) error {
+	if format != FormatJPEG {
+		return fmt.Errorf("native: %w %s", ErrUnsupportedFormat, format)
+	}
+
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cfg, kind, err := image.DecodeConfig(f)
+	if err != nil {
+		return fmt.Errorf("native: %w", err)
+	}
+	if cfg.Width*cfg.Height > maxNativePixels {
+		return fmt.Errorf("native: %dx%d %s image is too large", cfg.Width, cfg.Height, kind)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return err
+	}
+
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return fmt.Errorf("native: %w", err)
+	}
+
+	// Resize before rotating, so only the small image is transformed
+	thumb := resizeToFit(src, size)
+	if m, err := metadata.ReadFile(sourcePath); err == nil {
+		thumb = orient(thumb, m.Orientation)
+	}
+
+	quality := n.Quality
+	if quality == 0 {
+		quality = 85
+	}
+
+	out, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(out, thumb, &jpeg.Options{Quality: quality}); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// resizeToFit scales img down, preserving its aspect ratio, so its longer
+// side is at most size, or keeps its size when size is 0. Transparent areas
+// are flattened onto white, since the result is encoded without alpha.
+func resizeToFit(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if size > 0 && (w > size || h > size) {
+		if w >= h {
+			w, h = size, max(1, (h*size+w/2)/w)
+		} else {
+			w, h = max(1, (w*size+h/2)/h), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	if w == b.Dx() && h == b.Dy() {
+		draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+		return dst
+	}
+	// Catmull-Rom widens its kernel when shrinking, avoiding the aliasing
+	// of cheaper filters on large downscales
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	return dst
+}
+
+// orient applies an EXIF orientation (1-8) so the image displays upright
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		// Orientations 5-8 swap width and height
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := range h {
+		for x := range w {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // Rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // Transposed
+				dx, dy = y, x
+			case 6: // Rotate 90° clockwise to display
+				dx, dy = h-1-y, x
+			case 7: // Transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // Rotate 90° counter-clockwise to display
+				dx, dy = y, w-1-x
+			}
+			si := img.PixOffset(b.Min.X+x, b.Min.Y+y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], img.Pix[si:si+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,131 @@
+package importer
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vieira/tidyphotos/internal/db"
+)
+
+// DefaultTranscodeCacheSize bounds the transcode cache unless overridden
+// with SetTranscodeCacheSize
+const DefaultTranscodeCacheSize = 2 << 30
+
+// webFormats are the extensions browsers display natively
+var webFormats = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+	".avif": true,
+}
+
+// NeedsTranscode reports whether browsers need a photo converted before
+// they can display it, e.g. HEIC. Videos are streamed as they are.
+func NeedsTranscode(path string) bool {
+	return !webFormats[strings.ToLower(filepath.Ext(path))] && !isVideoFile(path)
+}
+
+// SetTranscodeCacheSize bounds the disk space used by Transcode, in bytes
+func (imp *Importer) SetTranscodeCacheSize(size int64) {
+	imp.transcodeMu.Lock()
+	defer imp.transcodeMu.Unlock()
+	imp.transcodeCacheSize = size
+}
+
+// Transcode returns a full-size copy of a photo in the first of formats
+// the thumbnail generator can write, for originals browsers can't display.
+// Copies are cached under cache/transcodes, evicting the least recently
+// used ones once the cache outgrows its size.
+func (imp *Importer) Transcode(photo *db.Photo, formats []ImageFormat) (string, ImageFormat, error) {
+	prefix := strconv.FormatInt(photo.ID, 10)
+	base := prefix + "-" + renditionVersion(photo)
+
+	path, format, generated, err := imp.render(photo, imp.transcodesDir, prefix, base, 0, formats)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Use is tracked apart from the modification time, which is served as
+	// Last-Modified and must stay put for conditional requests
+	imp.transcodeMu.Lock()
+	imp.transcodeUsed[path] = time.Now()
+	imp.transcodeMu.Unlock()
+
+	if generated {
+		imp.evictTranscodes(path)
+	}
+	return path, format, nil
+}
+
+// evictTranscodes removes the least recently used transcodes until the
+// cache fits its size, keeping the one just written. Transcodes not served
+// since startup count as last used when they were written.
+func (imp *Importer) evictTranscodes(keep string) {
+	imp.transcodeMu.Lock()
+	defer imp.transcodeMu.Unlock()
+
+	entries, err := os.ReadDir(imp.transcodesDir)
+	if err != nil {
+		return
+	}
+
+	type cached struct {
+		path   string
+		size   int64
+		usedAt time.Time
+	}
+	var files []cached
+	var total int64
+	for _, entry := range entries {
+		// Skip generators' temporary files
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(imp.transcodesDir, entry.Name())
+		usedAt := info.ModTime()
+		if used, ok := imp.transcodeUsed[path]; ok && used.After(usedAt) {
+			usedAt = used
+		}
+		files = append(files, cached{path, info.Size(), usedAt})
+		total += info.Size()
+	}
+
+	// Forget transcodes replaced or removed since they were served
+	onDisk := make(map[string]bool, len(files))
+	for _, f := range files {
+		onDisk[f.path] = true
+	}
+	for path := range imp.transcodeUsed {
+		if !onDisk[path] {
+			delete(imp.transcodeUsed, path)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].usedAt.Before(files[j].usedAt) })
+
+	for _, f := range files {
+		if total <= imp.transcodeCacheSize {
+			break
+		}
+		if f.path == keep {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			log.Printf("⚠️  Failed to evict transcode %s: %v", f.path, err)
+			continue
+		}
+		delete(imp.transcodeUsed, f.path)
+		total -= f.size
+	}
+}
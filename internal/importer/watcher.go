@@ -0,0 +1,372 @@
+package importer
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/vieira/tidyphotos/internal/db"
+)
+
+// ChangeType is the kind of library update a Change describes
+type ChangeType string
+
+const (
+	PhotoAdded   ChangeType = "added"   // A new file was imported
+	PhotoUpdated ChangeType = "updated" // A file was rewritten, or reappeared after going missing
+	PhotoMoved   ChangeType = "moved"   // A file was renamed or moved; ID and tags are kept
+	PhotoMissing ChangeType = "missing" // A file was deleted or moved out of the library
+)
+
+// Change is a library update made by the watcher
+type Change struct {
+	Type    ChangeType `json:"type"`
+	PhotoID int64      `json:"id"`
+	Path    string     `json:"path"`
+}
+
+// MinDebounce is the shortest debounce period Watch accepts
+const MinDebounce = 100 * time.Millisecond
+
+// Watcher keeps the database in sync with the photos directory while the
+// server runs. Filesystem events are debounced per path, so a file being
+// copied is imported once it has been quiet for the debounce period.
+// Events are collected and processed on separate goroutines, so the kernel
+// queue keeps being drained while a large batch is imported.
+type Watcher struct {
+	imp      *Importer
+	fsw      *fsnotify.Watcher
+	debounce time.Duration
+	onChange func(Change)
+
+	mu      sync.Mutex
+	pending map[string]time.Time // Path -> time of its latest event
+	rescan  bool                 // Events were dropped; the whole tree must be checked
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Watch starts watching the photos directory and every directory below it.
+// onChange, if not nil, is called from the watcher goroutine after each
+// change is written to the database. Returns an error if debounce is shorter
+// than MinDebounce.
+func (imp *Importer) Watch(debounce time.Duration, onChange func(Change)) (*Watcher, error) {
+	if debounce < MinDebounce {
+		return nil, fmt.Errorf("debounce %v is shorter than %v", debounce, MinDebounce)
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		imp:      imp,
+		fsw:      fsw,
+		debounce: debounce,
+		onChange: onChange,
+		pending:  make(map[string]time.Time),
+		done:     make(chan struct{}),
+	}
+
+	if err := w.addTree(imp.photosDir, false); err != nil {
+		fsw.Close()
+		return nil, err
+	}
+
+	w.wg.Add(2)
+	go w.run()
+	go w.process()
+
+	log.Printf("👀 Watching %s for changes", imp.photosDir)
+	return w, nil
+}
+
+// Close stops the watcher. Pending events are dropped.
+func (w *Watcher) Close() error {
+	close(w.done)
+	err := w.fsw.Close()
+	w.wg.Wait()
+	return err
+}
+
+// run collects filesystem events into pending
+func (w *Watcher) run() {
+	defer w.wg.Done()
+
+	for {
+		select {
+		case <-w.done:
+			return
+
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			// Permission and timestamp changes don't affect the library
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			w.mu.Lock()
+			w.pending[event.Name] = time.Now()
+			w.mu.Unlock()
+
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				log.Printf("⚠️  Watcher dropped events, rescanning %s", w.imp.photosDir)
+				w.mu.Lock()
+				w.rescan = true
+				w.mu.Unlock()
+				continue
+			}
+			log.Printf("⚠️  Watcher error: %v", err)
+		}
+	}
+}
+
+// process flushes pending paths as they settle, after rescanning the tree
+// if events were dropped
+func (w *Watcher) process() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.debounce / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+
+		case <-ticker.C:
+			w.mu.Lock()
+			rescan := w.rescan
+			w.rescan = false
+			w.mu.Unlock()
+
+			if rescan {
+				w.rescanTree()
+			}
+			w.flush()
+		}
+	}
+}
+
+// rescanTree catches up with changes whose events were dropped: every
+// directory is watched again, files gone from disk are flagged missing and
+// new ones are imported
+func (w *Watcher) rescanTree() {
+	if err := w.addTree(w.imp.photosDir, false); err != nil {
+		log.Printf("⚠️  Failed to watch %s: %v", w.imp.photosDir, err)
+	}
+	if err := w.imp.ScanAndImport(); err != nil {
+		log.Printf("⚠️  Rescan warning: %v", err)
+	}
+}
+
+// flush processes every path whose last event is older than the debounce
+// period. Removals go first so that a move whose two halves settle together
+// finds the old path already flagged missing.
+func (w *Watcher) flush() {
+	w.mu.Lock()
+	var ready []string
+	for path, last := range w.pending {
+		if time.Since(last) >= w.debounce {
+			ready = append(ready, path)
+			delete(w.pending, path)
+		}
+	}
+	w.mu.Unlock()
+
+	if len(ready) == 0 {
+		return
+	}
+	sort.Strings(ready)
+
+	// Events are only hints: what is on disk now decides what happened
+	var present []string
+	var missing []int64
+	for _, path := range ready {
+		if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+			missing = append(missing, w.removed(path)...)
+		} else {
+			present = append(present, path)
+		}
+	}
+
+	for _, path := range present {
+		info, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			// Files moved or copied in with the directory produce no events
+			// of their own
+			if err := w.addTree(path, true); err != nil {
+				log.Printf("⚠️  Failed to watch %s: %v", path, err)
+			}
+			continue
+		}
+		if info.Mode().IsRegular() && isMediaFile(path) {
+			w.syncFile(path, info)
+		}
+	}
+
+	// Either half of a Live Photo or RAW+JPEG pair may be the one that just
+	// arrived
+	if len(present) > 0 {
+		for _, photo := range w.imp.groupCompanionFiles() {
+			w.notify(Change{Type: PhotoUpdated, PhotoID: photo.ID, Path: photo.Path})
+		}
+	}
+
+	w.imp.syncFolders()
+
+	// Only report photos that are still missing once moves within the
+	// batch have been relinked
+	for _, id := range missing {
+		photo, err := w.imp.db.GetPhoto(id)
+		if err != nil || !photo.MissingSince.Valid {
+			continue
+		}
+		log.Printf("  👻 Missing: %s (ID: %d)", photo.Path, photo.ID)
+		w.notify(Change{Type: PhotoMissing, PhotoID: photo.ID, Path: photo.Path})
+	}
+}
+
+// addTree watches dir and its subdirectories. With syncFiles set, image
+// files found along the way are synced as if they had just appeared.
+func (w *Watcher) addTree(dir string, syncFiles bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return w.fsw.Add(path)
+		}
+		if syncFiles && d.Type().IsRegular() && isMediaFile(path) {
+			if info, err := d.Info(); err == nil {
+				w.syncFile(path, info)
+			}
+		}
+		return nil
+	})
+}
+
+// removed flags the photo at path, or every photo below it when path was a
+// directory, as missing and returns their IDs
+func (w *Watcher) removed(path string) []int64 {
+	// A directory renamed within the library keeps its watch under the old
+	// name. Drop it: the new name gets its own when its event is processed.
+	w.fsw.Remove(path)
+
+	ids, err := w.imp.db.MarkPhotosMissing(path)
+	if err != nil {
+		log.Printf("❌ Failed to mark %s missing: %v", path, err)
+		return nil
+	}
+	return ids
+}
+
+// syncFile brings the database up to date with an image file that was
+// created, written or moved to path
+func (w *Watcher) syncFile(path string, info os.FileInfo) {
+	existing, err := w.imp.db.GetPhotoByPath(path)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("❌ Failed to look up %s: %v", path, err)
+		return
+	}
+
+	if existing != nil {
+		w.refresh(existing, info)
+		return
+	}
+
+	photo := w.imp.readPhotoFile(path, info)
+
+	// A file with the content of a photo whose own file is gone is that
+	// photo, moved: relink it instead of importing a copy
+	if photo.ContentHash.Valid {
+		if moved := w.imp.findMovedPhoto(photo.ContentHash.String); moved != nil {
+			if err := w.imp.db.RelinkPhoto(moved.ID, path, photo.Filename); err != nil {
+				log.Printf("❌ Failed to relink %s: %v", path, err)
+				return
+			}
+			log.Printf("  🚚 Moved: %s -> %s (ID: %d)", moved.Path, path, moved.ID)
+			w.notify(Change{Type: PhotoMoved, PhotoID: moved.ID, Path: path})
+			return
+		}
+	}
+
+	if _, err := w.imp.insertPhoto(photo); err != nil {
+		log.Printf("❌ Failed to import %s: %v", photo.Filename, err)
+		return
+	}
+	w.notify(Change{Type: PhotoAdded, PhotoID: photo.ID, Path: path})
+}
+
+// refresh re-reads an already imported file if its content changed, and
+// clears its missing flag if it had been set
+func (w *Watcher) refresh(existing *db.Photo, info os.FileInfo) {
+	hash, _, err := hashFile(existing.Path)
+	if err != nil {
+		log.Printf("⚠️  Failed to hash %s: %v", existing.Filename, err)
+		return
+	}
+
+	if existing.ContentHash.Valid && existing.ContentHash.String == hash {
+		if existing.MissingSince.Valid {
+			if err := w.imp.db.RelinkPhoto(existing.ID, existing.Path, existing.Filename); err != nil {
+				log.Printf("❌ Failed to restore %s: %v", existing.Filename, err)
+				return
+			}
+			log.Printf("  ♻️  Restored: %s (ID: %d)", existing.Filename, existing.ID)
+			w.notify(Change{Type: PhotoUpdated, PhotoID: existing.ID, Path: existing.Path})
+		}
+		return
+	}
+
+	photo := w.imp.readPhotoFile(existing.Path, info)
+	photo.ID = existing.ID
+	if err := w.imp.db.UpdatePhotoFile(photo); err != nil {
+		log.Printf("❌ Failed to update %s: %v", photo.Filename, err)
+		return
+	}
+	w.imp.generateThumbnail(photo)
+
+	log.Printf("  ✏️  Updated: %s (ID: %d)", photo.Filename, photo.ID)
+	w.notify(Change{Type: PhotoUpdated, PhotoID: photo.ID, Path: photo.Path})
+}
+
+// findMovedPhoto returns a photo with the given content hash whose file no
+// longer exists at its recorded path, or nil
+func (imp *Importer) findMovedPhoto(hash string) *db.Photo {
+	candidates, err := imp.db.GetPhotosByContentHash(hash)
+	if err != nil {
+		return nil
+	}
+	for i := range candidates {
+		if _, err := os.Stat(candidates[i].Path); errors.Is(err, fs.ErrNotExist) {
+			return &candidates[i]
+		}
+	}
+	return nil
+}
+
+func (w *Watcher) notify(c Change) {
+	if w.onChange != nil {
+		w.onChange(c)
+	}
+}
@@ -0,0 +1,421 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// box is an ISOBMFF box header
+type box struct {
+	typ     string
+	dataOff int64 // Start of the payload
+	size    int64 // Payload size
+}
+
+// heifItem is an item of a HEIF meta box
+type heifItem struct {
+	typ         string
+	contentType string
+	construct   uint16 // 0: file offsets, 1: offsets into idat
+	extents     [][2]uint64
+	properties  []int // 1-based indexes into ipco
+}
+
+// readISOBMFF reads HEIC/HEIF/AVIF files: the Exif and XMP items of the meta
+// box, and the spatial extent of the primary item for its dimensions.
+// QuickTime and MP4 movies share the container and are read by readMovie.
+func readISOBMFF(r io.ReaderAt, size int64, m, xmp *Metadata) error {
+	var meta *box
+	for off := int64(0); off+8 <= size; {
+		b, err := readBoxHeader(r, off, size)
+		if err != nil {
+			return err
+		}
+		switch b.typ {
+		case "moov":
+			return readMovie(r, b, m)
+		case "meta":
+			meta = &b
+		}
+		if meta != nil {
+			break
+		}
+		off = b.dataOff + b.size
+	}
+	if meta == nil {
+		return errNoMovieOrMeta
+	}
+
+	data, err := readAt(r, meta.dataOff, meta.size)
+	if err != nil {
+		return err
+	}
+	if len(data) < 4 {
+		return errors.New("truncated meta box")
+	}
+
+	// meta is a full box: skip version and flags
+	children := parseBoxes(data[4:])
+
+	items := make(map[uint32]*heifItem)
+	item := func(id uint32) *heifItem {
+		if items[id] == nil {
+			items[id] = &heifItem{}
+		}
+		return items[id]
+	}
+
+	var primary uint32
+	var properties [][]byte // ispe payloads by 1-based ipco index; nil for other properties
+	var idat []byte
+
+	for _, child := range children {
+		payload := child.payload
+		switch child.typ {
+		case "pitm":
+			if len(payload) >= 6 && payload[0] == 0 {
+				primary = uint32(binary.BigEndian.Uint16(payload[4:]))
+			} else if len(payload) >= 8 {
+				primary = binary.BigEndian.Uint32(payload[4:])
+			}
+
+		case "iinf":
+			parseIinf(payload, item)
+
+		case "iloc":
+			parseIloc(payload, item)
+
+		case "idat":
+			idat = payload
+
+		case "iprp":
+			for _, p := range parseBoxes(payload) {
+				switch p.typ {
+				case "ipco":
+					for _, prop := range parseBoxes(p.payload) {
+						if prop.typ == "ispe" {
+							properties = append(properties, prop.payload)
+						} else {
+							properties = append(properties, nil)
+						}
+					}
+				case "ipma":
+					parseIpma(p.payload, item)
+				}
+			}
+		}
+	}
+
+	if p, ok := items[primary]; ok {
+		for _, index := range p.properties {
+			if index < 1 || index > len(properties) {
+				continue
+			}
+			if ispe := properties[index-1]; len(ispe) >= 12 {
+				m.Width = int(binary.BigEndian.Uint32(ispe[4:]))
+				m.Height = int(binary.BigEndian.Uint32(ispe[8:]))
+			}
+		}
+	}
+
+	for _, it := range items {
+		switch {
+		case it.typ == "Exif":
+			payload, err := readItem(r, it, idat)
+			if err != nil || len(payload) < 4 {
+				continue
+			}
+			// The payload starts with the offset of the TIFF header
+			skip := uint64(binary.BigEndian.Uint32(payload))
+			if 4+skip > uint64(len(payload)) {
+				continue
+			}
+			parseTIFF(trimExifHeader(payload[4+skip:]), m, false)
+
+		case it.typ == "mime" && it.contentType == "application/rdf+xml":
+			if payload, err := readItem(r, it, idat); err == nil {
+				parseXMP(payload, xmp)
+			}
+		}
+	}
+
+	return nil
+}
+
+// readBoxHeader reads the box starting at off
+func readBoxHeader(r io.ReaderAt, off, fileSize int64) (box, error) {
+	header, err := readAt(r, off, 8)
+	if err != nil {
+		return box{}, err
+	}
+	size := int64(binary.BigEndian.Uint32(header))
+	typ := string(header[4:8])
+	headerSize := int64(8)
+
+	switch size {
+	case 0:
+		// Box extends to the end of the file
+		size = fileSize - off
+	case 1:
+		large, err := readAt(r, off+8, 8)
+		if err != nil {
+			return box{}, err
+		}
+		size = int64(binary.BigEndian.Uint64(large))
+		headerSize = 16
+	}
+	if size < headerSize || off+size > fileSize {
+		return box{}, errors.New("invalid box size")
+	}
+
+	return box{typ: typ, dataOff: off + headerSize, size: size - headerSize}, nil
+}
+
+// childBox is a box parsed from an in-memory parent
+type childBox struct {
+	typ     string
+	payload []byte
+}
+
+// parseBoxes splits a payload into its child boxes, stopping at the first
+// malformed one
+func parseBoxes(data []byte) []childBox {
+	var boxes []childBox
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data))
+		typ := string(data[4:8])
+		headerSize := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return boxes
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			headerSize = 16
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			return boxes
+		}
+		boxes = append(boxes, childBox{typ: typ, payload: data[headerSize:size]})
+		data = data[size:]
+	}
+	return boxes
+}
+
+// parseIinf reads item types from the item info box
+func parseIinf(payload []byte, item func(uint32) *heifItem) {
+	if len(payload) < 6 {
+		return
+	}
+	rest := payload[6:]
+	if payload[0] != 0 {
+		if len(payload) < 8 {
+			return
+		}
+		rest = payload[8:]
+	}
+
+	for _, infe := range parseBoxes(rest) {
+		p := infe.payload
+		if infe.typ != "infe" || len(p) < 4 {
+			continue
+		}
+		version := p[0]
+		p = p[4:]
+
+		var id uint32
+		switch version {
+		case 2:
+			if len(p) < 8 {
+				continue
+			}
+			id = uint32(binary.BigEndian.Uint16(p))
+			p = p[4:]
+		case 3:
+			if len(p) < 10 {
+				continue
+			}
+			id = binary.BigEndian.Uint32(p)
+			p = p[6:]
+		default:
+			// Versions 0 and 1 predate item types
+			continue
+		}
+
+		it := item(id)
+		it.typ = string(p[:4])
+		p = p[4:]
+
+		// Item name, then for MIME items the content type
+		if _, rest, ok := bytes.Cut(p, []byte{0}); ok && it.typ == "mime" {
+			contentType, _, _ := bytes.Cut(rest, []byte{0})
+			it.contentType = string(contentType)
+		}
+	}
+}
+
+// parseIloc reads item locations from the item location box
+func parseIloc(payload []byte, item func(uint32) *heifItem) {
+	if len(payload) < 8 {
+		return
+	}
+	version := payload[0]
+	offsetSize := int(payload[4] >> 4)
+	lengthSize := int(payload[4] & 0xf)
+	baseOffsetSize := int(payload[5] >> 4)
+	indexSize := 0
+	if version == 1 || version == 2 {
+		indexSize = int(payload[5] & 0xf)
+	}
+
+	p := payload[6:]
+	read := func(n int) (uint64, bool) {
+		if n > len(p) {
+			return 0, false
+		}
+		var v uint64
+		for _, b := range p[:n] {
+			v = v<<8 | uint64(b)
+		}
+		p = p[n:]
+		return v, true
+	}
+
+	countSize := 2
+	if version == 2 {
+		countSize = 4
+	}
+	count, ok := read(countSize)
+	if !ok {
+		return
+	}
+
+	for range count {
+		idSize := 2
+		if version == 2 {
+			idSize = 4
+		}
+		id, ok := read(idSize)
+		if !ok {
+			return
+		}
+
+		var construct uint64
+		if version == 1 || version == 2 {
+			if construct, ok = read(2); !ok {
+				return
+			}
+			construct &= 0xf
+		}
+		if _, ok := read(2); !ok { // data_reference_index
+			return
+		}
+		base, ok := read(baseOffsetSize)
+		if !ok {
+			return
+		}
+		extentCount, ok := read(2)
+		if !ok {
+			return
+		}
+
+		it := item(uint32(id))
+		it.construct = uint16(construct)
+		for range extentCount {
+			if _, ok := read(indexSize); !ok {
+				return
+			}
+			offset, ok := read(offsetSize)
+			if !ok {
+				return
+			}
+			length, ok := read(lengthSize)
+			if !ok {
+				return
+			}
+			it.extents = append(it.extents, [2]uint64{base + offset, length})
+		}
+	}
+}
+
+// parseIpma reads which properties belong to which items
+func parseIpma(payload []byte, item func(uint32) *heifItem) {
+	if len(payload) < 8 {
+		return
+	}
+	version := payload[0]
+	wideIndex := payload[3]&1 != 0
+	count := binary.BigEndian.Uint32(payload[4:])
+	p := payload[8:]
+
+	for range count {
+		var id uint32
+		if version < 1 {
+			if len(p) < 3 {
+				return
+			}
+			id = uint32(binary.BigEndian.Uint16(p))
+			p = p[2:]
+		} else {
+			if len(p) < 5 {
+				return
+			}
+			id = binary.BigEndian.Uint32(p)
+			p = p[4:]
+		}
+
+		n := int(p[0])
+		p = p[1:]
+
+		it := item(id)
+		for range n {
+			var index int
+			if wideIndex {
+				if len(p) < 2 {
+					return
+				}
+				index = int(binary.BigEndian.Uint16(p) & 0x7fff)
+				p = p[2:]
+			} else {
+				if len(p) < 1 {
+					return
+				}
+				index = int(p[0] & 0x7f)
+				p = p[1:]
+			}
+			it.properties = append(it.properties, index)
+		}
+	}
+}
+
+// readItem concatenates an item's extents
+func readItem(r io.ReaderAt, it *heifItem, idat []byte) ([]byte, error) {
+	var out []byte
+	for _, e := range it.extents {
+		offset, length := e[0], e[1]
+		if uint64(len(out))+length > maxSegmentSize {
+			return nil, errors.New("item too large")
+		}
+
+		switch it.construct {
+		case 0:
+			data, err := readAt(r, int64(offset), int64(length))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, data...)
+		case 1:
+			if offset+length > uint64(len(idat)) {
+				return nil, errors.New("item extent outside idat")
+			}
+			out = append(out, idat[offset:offset+length]...)
+		default:
+			return nil, errors.New("unsupported item construction method")
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,80 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// xmpNamespace prefixes XMP packets in JPEG APP1 segments
+var xmpNamespace = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+// readJPEG walks the JPEG markers up to the image data, reading the Exif and
+// XMP APP1 segments and the frame header
+func readJPEG(r io.ReaderAt, size int64, m, xmp *Metadata) error {
+	off := int64(2)
+	for off+4 <= size {
+		header, err := readAt(r, off, 4)
+		if err != nil {
+			return err
+		}
+		if header[0] != 0xFF {
+			return errors.New("invalid JPEG marker")
+		}
+
+		marker := header[1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte before the marker
+			off++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// Standalone markers carry no length
+			off += 2
+			continue
+		case marker == 0xD9 || marker == 0xDA:
+			// End of image, or start of scan: no metadata follows
+			return nil
+		}
+
+		length := int64(binary.BigEndian.Uint16(header[2:]))
+		if length < 2 {
+			return errors.New("invalid JPEG segment length")
+		}
+
+		switch {
+		case marker == 0xE1:
+			payload, err := readAt(r, off+4, length-2)
+			if err != nil {
+				return err
+			}
+			if bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+				// A broken Exif block still leaves the frame size to read
+				parseTIFF(payload[6:], m, false)
+			} else if bytes.HasPrefix(payload, xmpNamespace) {
+				parseXMP(payload[len(xmpNamespace):], xmp)
+			}
+
+		case isSOF(marker):
+			payload, err := readAt(r, off+4, min(length-2, 5))
+			if err != nil {
+				return err
+			}
+			if len(payload) == 5 {
+				height := int(binary.BigEndian.Uint16(payload[1:]))
+				width := int(binary.BigEndian.Uint16(payload[3:]))
+				m.Width, m.Height = width, height
+			}
+		}
+
+		off += 2 + length
+	}
+	return nil
+}
+
+// isSOF reports whether a marker starts a frame. C4, C8 and CC share the
+// range but define Huffman tables, a JPEG extension and arithmetic coding.
+func isSOF(marker byte) bool {
+	return marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC
+}
@@ -0,0 +1,210 @@
+// Package metadata reads EXIF and XMP metadata from image files without
+// external tools. It understands JPEG, TIFF, PNG, WebP and HEIC/AVIF
+// containers, including the TIFF-based and Fujifilm camera RAW formats, and
+// extracts the handful of tags tidyphotos stores, plus the equivalent movie
+// metadata of QuickTime and MP4 videos.
+package metadata
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrUnsupported is returned for files in a container format Read does not
+// understand
+var ErrUnsupported = errors.New("unsupported image format")
+
+// maxSegmentSize bounds how much of a file is read for one metadata block
+const maxSegmentSize = 16 << 20
+
+// Metadata is the metadata of one image. Dates use EXIF's
+// "2006:01:02 15:04:05" layout, without zone; zones are in the Offset fields.
+// Zero values mean the tag was absent.
+type Metadata struct {
+	Make      string
+	Model     string
+	LensModel string
+
+	DateTimeOriginal    string
+	CreateDate          string
+	OffsetTime          string
+	OffsetTimeOriginal  string
+	OffsetTimeDigitized string
+	SubSecTimeOriginal  string
+
+	ExposureTime float64 // Seconds
+	FNumber      float64
+	FocalLength  float64 // Millimetres
+	ISO          int
+
+	Orientation int // EXIF orientation, 1-8
+	Width       int
+	Height      int
+
+	GPS *GPS
+
+	// Shared by the still and movie of an Apple Live Photo
+	ContentIdentifier string
+
+	// Videos only
+	MediaCreateDate string  // Movie creation time, in UTC
+	Duration        float64 // Seconds
+	VideoCodec      string  // e.g. "h264", "hevc", or the sample entry type
+}
+
+// GPS is a position in signed decimal degrees
+type GPS struct {
+	Latitude  float64
+	Longitude float64
+	Altitude  *float64 // Metres above sea level, negative below
+}
+
+// ReadFile reads the metadata of the image at path
+func ReadFile(path string) (*Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return Read(f, info.Size())
+}
+
+// Read reads the metadata of an image of the given size, detecting its
+// container from the leading bytes
+func Read(r io.ReaderAt, size int64) (*Metadata, error) {
+	head := make([]byte, 16)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+
+	m := &Metadata{}
+	xmp := &Metadata{}
+
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8}):
+		err = readJPEG(r, size, m, xmp)
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		err = readPNG(r, size, m, xmp)
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		err = readWebP(r, size, m, xmp)
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		err = readISOBMFF(r, size, m, xmp)
+	case len(head) >= 8 && isQuickTimeAtom(string(head[4:8])):
+		// Older QuickTime movies start without a file type box
+		err = readISOBMFF(r, size, m, xmp)
+	case bytes.HasPrefix(head, []byte("FUJIFILMCCD-RAW")):
+		// Fujifilm RAW files keep their metadata in the embedded JPEG
+		var off, length int64
+		if off, length, err = rafJPEG(r); err == nil {
+			err = readJPEG(io.NewSectionReader(r, off, length), length, m, xmp)
+		}
+	case bytes.HasPrefix(head, []byte("II*\x00")) || bytes.HasPrefix(head, []byte("MM\x00*")):
+		var data []byte
+		if data, err = readAt(r, 0, min(size, maxSegmentSize)); err == nil {
+			err = parseTIFF(data, m, true)
+		}
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m.fillFrom(xmp)
+	return m, nil
+}
+
+// isQuickTimeAtom reports whether typ is a top-level box QuickTime movies
+// can start with
+func isQuickTimeAtom(typ string) bool {
+	switch typ {
+	case "moov", "mdat", "wide", "free", "skip":
+		return true
+	}
+	return false
+}
+
+// fillFrom copies fields that m lacks from other. EXIF wins over XMP, which
+// is often rewritten by editors and less precise.
+func (m *Metadata) fillFrom(other *Metadata) {
+	fillString := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+	fillString(&m.Make, other.Make)
+	fillString(&m.Model, other.Model)
+	fillString(&m.LensModel, other.LensModel)
+
+	// Date, zone and subseconds belong together
+	if m.DateTimeOriginal == "" && other.DateTimeOriginal != "" {
+		m.DateTimeOriginal = other.DateTimeOriginal
+		m.OffsetTimeOriginal = other.OffsetTimeOriginal
+		m.SubSecTimeOriginal = other.SubSecTimeOriginal
+	}
+	if m.CreateDate == "" && other.CreateDate != "" {
+		m.CreateDate = other.CreateDate
+		m.OffsetTimeDigitized = other.OffsetTimeDigitized
+	}
+
+	fillFloat := func(dst *float64, src float64) {
+		if *dst == 0 {
+			*dst = src
+		}
+	}
+	fillFloat(&m.ExposureTime, other.ExposureTime)
+	fillFloat(&m.FNumber, other.FNumber)
+	fillFloat(&m.FocalLength, other.FocalLength)
+
+	fillInt := func(dst *int, src int) {
+		if *dst == 0 {
+			*dst = src
+		}
+	}
+	fillInt(&m.ISO, other.ISO)
+	fillInt(&m.Orientation, other.Orientation)
+	if m.Width == 0 || m.Height == 0 {
+		m.Width, m.Height = other.Width, other.Height
+	}
+
+	if m.GPS == nil {
+		m.GPS = other.GPS
+	}
+}
+
+// setDimensions records the image size unless a more authoritative source
+// already did
+func (m *Metadata) setDimensions(width, height int) {
+	if m.Width == 0 && m.Height == 0 && width > 0 && height > 0 {
+		m.Width, m.Height = width, height
+	}
+}
+
+// readAt reads exactly n bytes at off
+func readAt(r io.ReaderAt, off, n int64) ([]byte, error) {
+	if n < 0 || n > maxSegmentSize {
+		return nil, fmt.Errorf("metadata block of %d bytes is too large", n)
+	}
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, off); err != nil && !(errors.Is(err, io.EOF) && n == 0) {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// trimExifHeader strips the "Exif\0\0" prefix some containers keep in front
+// of the TIFF header
+func trimExifHeader(data []byte) []byte {
+	return bytes.TrimPrefix(data, []byte("Exif\x00\x00"))
+}
@@ -0,0 +1,375 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// movieEpoch is the origin of QuickTime and MP4 timestamps
+var movieEpoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// videoCodecs names the sample entry types of common video codecs
+var videoCodecs = map[string]string{
+	"avc1": "h264",
+	"avc3": "h264",
+	"hvc1": "hevc",
+	"hev1": "hevc",
+	"av01": "av1",
+	"vp08": "vp8",
+	"vp09": "vp9",
+	"mp4v": "mpeg4",
+	"jpeg": "mjpeg",
+	"apcn": "prores",
+	"apch": "prores",
+	"apcs": "prores",
+	"apco": "prores",
+	"ap4h": "prores",
+}
+
+// readMovie reads a QuickTime or MP4 movie box: its duration and creation
+// time, the codec and display size of its first video track, and the Apple
+// metadata keys iPhones record (local creation date, location, make and
+// model)
+func readMovie(r io.ReaderAt, moov box, m *Metadata) error {
+	children, err := readChildBoxes(r, moov)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		switch child.typ {
+		case "mvhd":
+			data, err := readAt(r, child.dataOff, min(child.size, 32))
+			if err != nil {
+				return err
+			}
+			parseMvhd(data, m)
+
+		case "trak":
+			if m.VideoCodec == "" {
+				readTrack(r, child, m)
+			}
+
+		case "meta":
+			readAppleMetadata(r, child, m)
+
+		case "udta":
+			readUserData(r, child, m)
+		}
+	}
+	return nil
+}
+
+// parseMvhd reads the creation time and duration of the movie header
+func parseMvhd(data []byte, m *Metadata) {
+	var created, timescale, duration uint64
+	switch {
+	case len(data) >= 20 && data[0] == 0:
+		created = uint64(binary.BigEndian.Uint32(data[4:]))
+		timescale = uint64(binary.BigEndian.Uint32(data[12:]))
+		duration = uint64(binary.BigEndian.Uint32(data[16:]))
+	case len(data) >= 32 && data[0] == 1:
+		created = binary.BigEndian.Uint64(data[4:])
+		timescale = uint64(binary.BigEndian.Uint32(data[20:]))
+		duration = binary.BigEndian.Uint64(data[24:])
+	default:
+		return
+	}
+
+	if timescale > 0 {
+		m.Duration = float64(duration) / float64(timescale)
+	}
+	// Cameras without a clock write zero
+	if created > 0 {
+		m.MediaCreateDate = movieEpoch.Add(time.Duration(created) * time.Second).Format("2006:01:02 15:04:05")
+	}
+}
+
+// readTrack records the codec and display size of a video track
+func readTrack(r io.ReaderAt, trak box, m *Metadata) {
+	children, err := readChildBoxes(r, trak)
+	if err != nil {
+		return
+	}
+
+	var width, height int
+	var codec string
+	for _, child := range children {
+		switch child.typ {
+		case "tkhd":
+			data, err := readAt(r, child.dataOff, min(child.size, 96))
+			if err != nil {
+				return
+			}
+			width, height = parseTkhd(data)
+
+		case "mdia":
+			mdia, err := readChildBoxes(r, child)
+			if err != nil {
+				return
+			}
+			var isVideo bool
+			var minf *box
+			for i, b := range mdia {
+				switch b.typ {
+				case "hdlr":
+					data, err := readAt(r, b.dataOff, min(b.size, 12))
+					isVideo = err == nil && len(data) == 12 && string(data[8:12]) == "vide"
+				case "minf":
+					minf = &mdia[i]
+				}
+			}
+			if !isVideo || minf == nil {
+				return
+			}
+			codec = sampleEntryType(r, *minf)
+		}
+	}
+
+	if codec == "" {
+		return
+	}
+	if name, ok := videoCodecs[codec]; ok {
+		codec = name
+	}
+	m.VideoCodec = strings.TrimSpace(codec)
+	m.setDimensions(width, height)
+}
+
+// parseTkhd returns a track's display size, swapping width and height
+// when its matrix rotates the picture by a quarter turn
+func parseTkhd(data []byte) (width, height int) {
+	// The matrix and size follow the version-dependent times
+	off := 40
+	if len(data) > 0 && data[0] == 1 {
+		off = 52
+	}
+	if len(data) < off+44 {
+		return 0, 0
+	}
+
+	matrix := data[off:]
+	a := int32(binary.BigEndian.Uint32(matrix[0:]))
+	// 16.16 fixed point
+	width = int(binary.BigEndian.Uint32(matrix[36:]) >> 16)
+	height = int(binary.BigEndian.Uint32(matrix[40:]) >> 16)
+	if a == 0 {
+		width, height = height, width
+	}
+	return width, height
+}
+
+// sampleEntryType returns the type of the first sample description under
+// minf/stbl/stsd, which names the codec
+func sampleEntryType(r io.ReaderAt, minf box) string {
+	b, ok := findChildBox(r, minf, "stbl")
+	if !ok {
+		return ""
+	}
+	if b, ok = findChildBox(r, b, "stsd"); !ok {
+		return ""
+	}
+	// Full box header and entry count, then the first entry's size and type
+	data, err := readAt(r, b.dataOff, min(b.size, 16))
+	if err != nil || len(data) < 16 {
+		return ""
+	}
+	return string(data[12:16])
+}
+
+// readAppleMetadata reads the mdta keys QuickTime movies from Apple devices
+// carry in moov/meta
+func readAppleMetadata(r io.ReaderAt, meta box, m *Metadata) {
+	data, err := readAt(r, meta.dataOff, meta.size)
+	if err != nil || len(data) < 8 {
+		return
+	}
+	// QuickTime's meta box has no version and flags, MP4's does
+	if string(data[4:8]) != "hdlr" {
+		data = data[4:]
+	}
+
+	var keys []string
+	var items []childBox
+	for _, child := range parseBoxes(data) {
+		switch child.typ {
+		case "keys":
+			keys = parseMetadataKeys(child.payload)
+		case "ilst":
+			items = parseBoxes(child.payload)
+		}
+	}
+
+	values := make(map[string]string)
+	for _, item := range items {
+		// Items are typed by the 1-based index of their key
+		index := int(binary.BigEndian.Uint32([]byte(item.typ)))
+		if index < 1 || index > len(keys) {
+			continue
+		}
+		for _, d := range parseBoxes(item.payload) {
+			// Type indicator and locale precede the value; 1 is UTF-8
+			if d.typ == "data" && len(d.payload) >= 8 && binary.BigEndian.Uint32(d.payload) == 1 {
+				values[keys[index-1]] = string(d.payload[8:])
+				break
+			}
+		}
+	}
+
+	if v := values["com.apple.quicktime.make"]; v != "" {
+		m.Make = v
+	}
+	if v := values["com.apple.quicktime.model"]; v != "" {
+		m.Model = v
+	}
+	if date, offset, ok := parseISODate(values["com.apple.quicktime.creationdate"]); ok {
+		m.DateTimeOriginal, m.OffsetTimeOriginal = date, offset
+	}
+	if v := values["com.apple.quicktime.content.identifier"]; v != "" {
+		m.ContentIdentifier = v
+	}
+	if gps, ok := parseISO6709(values["com.apple.quicktime.location.ISO6709"]); ok {
+		m.GPS = gps
+	}
+}
+
+// parseMetadataKeys reads the key names of a keys box
+func parseMetadataKeys(payload []byte) []string {
+	if len(payload) < 8 {
+		return nil
+	}
+	count := binary.BigEndian.Uint32(payload[4:])
+	p := payload[8:]
+
+	var keys []string
+	for range count {
+		if len(p) < 8 {
+			break
+		}
+		size := binary.BigEndian.Uint32(p)
+		if size < 8 || uint64(size) > uint64(len(p)) {
+			break
+		}
+		// Namespace, usually "mdta", then the name
+		keys = append(keys, string(p[8:size]))
+		p = p[size:]
+	}
+	return keys
+}
+
+// readUserData reads the ISO 6709 location Android phones record in
+// moov/udta/©xyz
+func readUserData(r io.ReaderAt, udta box, m *Metadata) {
+	if m.GPS != nil {
+		return
+	}
+	b, ok := findChildBox(r, udta, "\xa9xyz")
+	if !ok {
+		return
+	}
+	data, err := readAt(r, b.dataOff, min(b.size, 64))
+	if err != nil || len(data) < 4 {
+		return
+	}
+	// Length and language code precede the string
+	if gps, ok := parseISO6709(string(data[4:])); ok {
+		m.GPS = gps
+	}
+}
+
+// readChildBoxes reads the box headers directly inside parent without
+// loading their payloads, which can be large
+func readChildBoxes(r io.ReaderAt, parent box) ([]box, error) {
+	var boxes []box
+	end := parent.dataOff + parent.size
+	for off := parent.dataOff; off+8 <= end; {
+		b, err := readBoxHeader(r, off, end)
+		if err != nil {
+			return boxes, err
+		}
+		boxes = append(boxes, b)
+		off = b.dataOff + b.size
+	}
+	return boxes, nil
+}
+
+// findChildBox returns the first box of type typ directly inside parent
+func findChildBox(r io.ReaderAt, parent box, typ string) (box, bool) {
+	children, _ := readChildBoxes(r, parent)
+	for _, b := range children {
+		if b.typ == typ {
+			return b, true
+		}
+	}
+	return box{}, false
+}
+
+// isoDateLayouts are the forms of Apple's creation date, with and without
+// a colon in the zone
+var isoDateLayouts = []string{
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05Z07:00",
+}
+
+// parseISODate converts an ISO 8601 date with zone into EXIF's layout and a
+// separate offset
+func parseISODate(value string) (date, offset string, ok bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range isoDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("2006:01:02 15:04:05"), t.Format("-07:00"), true
+		}
+	}
+	return "", "", false
+}
+
+// parseISO6709 parses a location such as "+37.3861-122.0839+010.000/":
+// signed latitude and longitude in degrees, then an optional altitude
+func parseISO6709(value string) (*GPS, bool) {
+	value = strings.TrimSuffix(strings.TrimRight(value, "\x00 "), "/")
+	if value == "" {
+		return nil, false
+	}
+
+	// Split before every sign
+	var parts []string
+	start := 0
+	for i := 1; i < len(value); i++ {
+		if value[i] == '+' || value[i] == '-' {
+			parts = append(parts, value[start:i])
+			start = i
+		}
+	}
+	parts = append(parts, value[start:])
+	if len(parts) < 2 {
+		return nil, false
+	}
+
+	var coords []float64
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return nil, false
+		}
+		coords = append(coords, v)
+	}
+	if coords[0] < -90 || coords[0] > 90 || coords[1] < -180 || coords[1] > 180 ||
+		(coords[0] == 0 && coords[1] == 0) {
+		return nil, false
+	}
+
+	gps := &GPS{Latitude: coords[0], Longitude: coords[1]}
+	if len(coords) > 2 {
+		alt := coords[2]
+		gps.Altitude = &alt
+	}
+	return gps, true
+}
+
+// errNoMovieOrMeta is returned for ISOBMFF files with neither a movie nor a
+// meta box
+var errNoMovieOrMeta = errors.New("no moov or meta box")
@@ -0,0 +1,135 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"strings"
+)
+
+// readPNG reads IHDR for the image size, eXIf for EXIF, and the text chunks
+// where XMP and ImageMagick-style raw EXIF profiles live
+func readPNG(r io.ReaderAt, size int64, m, xmp *Metadata) error {
+	off := int64(8)
+	for off+8 <= size {
+		header, err := readAt(r, off, 8)
+		if err != nil {
+			return err
+		}
+		length := int64(binary.BigEndian.Uint32(header))
+		typ := string(header[4:8])
+		dataOff := off + 8
+
+		switch typ {
+		case "IHDR":
+			data, err := readAt(r, dataOff, min(length, 8))
+			if err != nil {
+				return err
+			}
+			if len(data) == 8 {
+				m.Width = int(binary.BigEndian.Uint32(data))
+				m.Height = int(binary.BigEndian.Uint32(data[4:]))
+			}
+
+		case "eXIf":
+			data, err := readAt(r, dataOff, length)
+			if err != nil {
+				return err
+			}
+			parseTIFF(trimExifHeader(data), m, false)
+
+		case "tEXt", "zTXt", "iTXt":
+			data, err := readAt(r, dataOff, length)
+			if err != nil {
+				return err
+			}
+			keyword, text, ok := pngText(typ, data)
+			if !ok {
+				break
+			}
+			switch {
+			case keyword == "XML:com.adobe.xmp":
+				parseXMP(text, xmp)
+			case strings.HasPrefix(keyword, "Raw profile type exif"), keyword == "Raw profile type APP1":
+				if tiff, ok := decodeRawProfile(text); ok {
+					parseTIFF(trimExifHeader(tiff), m, false)
+				}
+			}
+
+		case "IEND":
+			return nil
+		}
+
+		// Chunk data is followed by a 4-byte CRC
+		off = dataOff + length + 4
+	}
+	return nil
+}
+
+// pngText decodes a tEXt, zTXt or iTXt chunk into its keyword and text
+func pngText(typ string, data []byte) (keyword string, text []byte, ok bool) {
+	key, rest, found := bytes.Cut(data, []byte{0})
+	if !found {
+		return "", nil, false
+	}
+	keyword = string(key)
+
+	switch typ {
+	case "tEXt":
+		return keyword, rest, true
+
+	case "zTXt":
+		// Compression method byte, then zlib data
+		if len(rest) < 1 {
+			return "", nil, false
+		}
+		text, err := inflate(rest[1:])
+		return keyword, text, err == nil
+
+	case "iTXt":
+		// Compression flag and method, then language and translated keyword
+		if len(rest) < 2 {
+			return "", nil, false
+		}
+		compressed := rest[0] == 1
+		_, rest, found = bytes.Cut(rest[2:], []byte{0})
+		if !found {
+			return "", nil, false
+		}
+		_, rest, found = bytes.Cut(rest, []byte{0})
+		if !found {
+			return "", nil, false
+		}
+		if !compressed {
+			return keyword, rest, true
+		}
+		text, err := inflate(rest)
+		return keyword, text, err == nil
+	}
+	return "", nil, false
+}
+
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(io.LimitReader(zr, maxSegmentSize))
+}
+
+// decodeRawProfile decodes ImageMagick's "Raw profile type" text: a blank
+// line, the profile name, its length, then the bytes as wrapped hex
+func decodeRawProfile(text []byte) ([]byte, bool) {
+	fields := strings.Fields(string(text))
+	if len(fields) < 3 {
+		return nil, false
+	}
+	data, err := hex.DecodeString(strings.Join(fields[2:], ""))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
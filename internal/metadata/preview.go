@@ -0,0 +1,226 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/jpeg"
+	"io"
+	"os"
+)
+
+// ErrNoPreview is returned for RAW files without a JPEG preview that image
+// decoders can read
+var ErrNoPreview = errors.New("no embedded preview")
+
+// TIFF tags locating the images of a RAW file
+const (
+	tagNewSubfileType  = 0x00FE
+	tagCompression     = 0x0103
+	tagStripOffsets    = 0x0111
+	tagStripByteCounts = 0x0117
+	tagSubIFDs         = 0x014A
+	tagJPEGOffset      = 0x0201
+	tagJPEGLength      = 0x0202
+)
+
+// maxIFDDepth bounds how deeply SubIFDs are followed
+const maxIFDDepth = 4
+
+// rafHeaderSize is how much of a Fujifilm RAF header locates its JPEG
+const rafHeaderSize = 92
+
+// ReadPreviewFile returns the largest JPEG preview embedded in the camera
+// RAW file at path
+func ReadPreviewFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return ReadPreview(f, info.Size())
+}
+
+// ReadPreview returns the largest JPEG preview embedded in a camera RAW file:
+// the JPEG of a Fujifilm RAF, or the largest baseline JPEG referenced from
+// the IFDs of TIFF-based formats such as CR2, NEF, ARW and DNG. Previews are
+// usually stored unrotated, so the RAW's orientation is written into the
+// preview when it carries none.
+func ReadPreview(r io.ReaderAt, size int64) ([]byte, error) {
+	head := make([]byte, 16)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+
+	var preview []byte
+	switch {
+	case bytes.HasPrefix(head, []byte("FUJIFILMCCD-RAW")):
+		off, length, err := rafJPEG(r)
+		if err != nil {
+			return nil, err
+		}
+		if preview, err = readAt(r, off, length); err != nil {
+			return nil, err
+		}
+		if !isDecodableJPEG(preview) {
+			return nil, ErrNoPreview
+		}
+		// This JPEG carries the RAF's own Exif, orientation included
+		return preview, nil
+
+	case bytes.HasPrefix(head, []byte("II*\x00")) || bytes.HasPrefix(head, []byte("MM\x00*")):
+		if preview, err = tiffPreview(r, size); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, ErrUnsupported
+	}
+
+	if m, err := Read(bytes.NewReader(preview), int64(len(preview))); err == nil && m.Orientation == 0 {
+		if raw, err := Read(r, size); err == nil && raw.Orientation > 1 {
+			preview = withOrientation(preview, raw.Orientation)
+		}
+	}
+	return preview, nil
+}
+
+// rafJPEG returns the offset and length of a RAF file's JPEG image
+func rafJPEG(r io.ReaderAt) (off, length int64, err error) {
+	header, err := readAt(r, 0, rafHeaderSize)
+	if err != nil {
+		return 0, 0, err
+	}
+	off = int64(binary.BigEndian.Uint32(header[84:]))
+	length = int64(binary.BigEndian.Uint32(header[88:]))
+	if off == 0 || length == 0 {
+		return 0, 0, ErrNoPreview
+	}
+	return off, length, nil
+}
+
+// tiffPreview reads the largest decodable JPEG referenced from the IFD0
+// chain of a TIFF-based RAW file or any of their SubIFDs. RAW data is often
+// stored as lossless JPEG too, which image decoders reject, so candidates
+// are tried largest first.
+func tiffPreview(r io.ReaderAt, size int64) ([]byte, error) {
+	data, err := readAt(r, 0, min(size, maxSegmentSize))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, ErrNoPreview
+	}
+
+	order := binary.ByteOrder(binary.LittleEndian)
+	if string(data[:2]) == "MM" {
+		order = binary.BigEndian
+	}
+
+	var candidates [][2]int64
+	seen := make(map[uint32]bool)
+	var walk func(offset uint32, depth int)
+	walk = func(offset uint32, depth int) {
+		for offset != 0 && !seen[offset] && depth <= maxIFDDepth {
+			seen[offset] = true
+			ifd, err := readIFD(data, order, offset)
+			if err != nil {
+				return
+			}
+
+			if off, ok := ifd[tagJPEGOffset].uint(0); ok {
+				if length, ok := ifd[tagJPEGLength].uint(0); ok {
+					candidates = append(candidates, [2]int64{int64(off), int64(length)})
+				}
+			}
+			// A JPEG stored as the IFD's single strip
+			if c, ok := ifd[tagCompression].uint(0); ok && (c == 6 || c == 7) && ifd[tagStripOffsets].count == 1 {
+				off, _ := ifd[tagStripOffsets].uint(0)
+				length, _ := ifd[tagStripByteCounts].uint(0)
+				candidates = append(candidates, [2]int64{int64(off), int64(length)})
+			}
+
+			sub := ifd[tagSubIFDs]
+			for i := range sub.count {
+				if off, ok := sub.uint(i); ok {
+					walk(uint32(off), depth+1)
+				}
+			}
+
+			offset = nextIFD(data, order, offset)
+		}
+	}
+	walk(order.Uint32(data[4:]), 0)
+
+	// Largest first
+	for len(candidates) > 0 {
+		best := 0
+		for i, c := range candidates {
+			if c[1] > candidates[best][1] {
+				best = i
+			}
+		}
+		c := candidates[best]
+		candidates = append(candidates[:best], candidates[best+1:]...)
+
+		if c[0] <= 0 || c[1] <= 0 || c[0]+c[1] > size {
+			continue
+		}
+		preview, err := readAt(r, c[0], c[1])
+		if err == nil && isDecodableJPEG(preview) {
+			return preview, nil
+		}
+	}
+	return nil, ErrNoPreview
+}
+
+// nextIFD returns the offset of the IFD following the one at offset, or 0
+func nextIFD(data []byte, order binary.ByteOrder, offset uint32) uint32 {
+	if uint64(offset)+2 > uint64(len(data)) {
+		return 0
+	}
+	end := uint64(offset) + 2 + uint64(order.Uint16(data[offset:]))*12
+	if end+4 > uint64(len(data)) {
+		return 0
+	}
+	return order.Uint32(data[end:])
+}
+
+// isDecodableJPEG reports whether data is a JPEG image decoders support,
+// as opposed to the lossless JPEG RAW data is often compressed with
+func isDecodableJPEG(data []byte) bool {
+	if !bytes.HasPrefix(data, []byte{0xFF, 0xD8}) {
+		return false
+	}
+	_, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	return err == nil
+}
+
+// withOrientation inserts an Exif segment holding only the orientation tag
+// after the start of a JPEG image
+func withOrientation(data []byte, orientation int) []byte {
+	tiff := []byte{
+		'M', 'M', 0, 42, 0, 0, 0, 8, // Header, IFD0 at 8
+		0, 1, // One entry
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, byte(orientation), 0, 0, // Orientation, SHORT
+		0, 0, 0, 0, // No next IFD
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := make([]byte, 0, len(data)+len(segment))
+	out = append(out, data[:2]...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
@@ -0,0 +1,348 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TIFF tag IDs read from IFD0, the Exif IFD, the GPS IFD and Apple's maker
+// note
+const (
+	tagImageWidth      = 0x0100
+	tagImageLength     = 0x0101
+	tagMake            = 0x010F
+	tagModel           = 0x0110
+	tagOrientation     = 0x0112
+	tagExifIFD         = 0x8769
+	tagGPSIFD          = 0x8825
+	tagExposureTime    = 0x829A
+	tagFNumber         = 0x829D
+	tagISO             = 0x8827
+	tagDateTimeOrig    = 0x9003
+	tagCreateDate      = 0x9004
+	tagOffsetTime      = 0x9010
+	tagOffsetTimeOrig  = 0x9011
+	tagOffsetTimeDigit = 0x9012
+	tagFocalLength     = 0x920A
+	tagMakerNote       = 0x927C
+	tagSubSecTimeOrig  = 0x9291
+	tagPixelXDimension = 0xA002
+	tagPixelYDimension = 0xA003
+	tagLensModel       = 0xA434
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+	tagGPSAltitudeRef  = 0x0005
+	tagGPSAltitude     = 0x0006
+
+	tagAppleContentIdentifier = 0x0011
+)
+
+// typeSizes is the byte size of each TIFF field type
+var typeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// maxIFDEntries guards against corrupt entry counts
+const maxIFDEntries = 1000
+
+// tiffField is one IFD entry with its value bytes resolved
+type tiffField struct {
+	typ   uint16
+	count uint32
+	value []byte
+	order binary.ByteOrder
+}
+
+// parseTIFF reads EXIF tags from a TIFF structure, such as the payload of a
+// JPEG APP1 segment. With fileDims the IFD0 image size is used as the image
+// dimensions, which is only right when the TIFF is the image itself.
+func parseTIFF(data []byte, m *Metadata, fileDims bool) error {
+	if len(data) < 8 {
+		return errors.New("truncated TIFF header")
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return errors.New("invalid TIFF byte order")
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return errors.New("invalid TIFF magic")
+	}
+
+	ifd0, err := readIFD(data, order, order.Uint32(data[4:]))
+	if err != nil {
+		return err
+	}
+
+	m.Make = firstString(m.Make, ifd0[tagMake].string())
+	m.Model = firstString(m.Model, ifd0[tagModel].string())
+	if v, ok := ifd0[tagOrientation].uint(0); ok && v >= 1 && v <= 8 {
+		m.Orientation = int(v)
+	}
+
+	if off, ok := ifd0[tagExifIFD].uint(0); ok {
+		// A broken sub-IFD shouldn't lose what IFD0 had
+		if exif, err := readIFD(data, order, uint32(off)); err == nil {
+			applyExifIFD(exif, m)
+		}
+	}
+
+	if off, ok := ifd0[tagGPSIFD].uint(0); ok {
+		if gps, err := readIFD(data, order, uint32(off)); err == nil {
+			applyGPSIFD(gps, m)
+		}
+	}
+
+	if fileDims {
+		setTIFFDimensions(data, order, ifd0, m)
+	}
+
+	return nil
+}
+
+// setTIFFDimensions records the size of the full-resolution image of a TIFF.
+// RAW files often make IFD0 a reduced-resolution thumbnail (subfile type 1)
+// and keep the full image in a SubIFD.
+func setTIFFDimensions(data []byte, order binary.ByteOrder, ifd0 map[uint16]tiffField, m *Metadata) {
+	ifd := ifd0
+	if t, ok := ifd0[tagNewSubfileType].uint(0); ok && t&1 != 0 {
+		sub := ifd0[tagSubIFDs]
+		for i := range sub.count {
+			off, ok := sub.uint(i)
+			if !ok {
+				continue
+			}
+			if s, err := readIFD(data, order, uint32(off)); err == nil {
+				if t, _ := s[tagNewSubfileType].uint(0); t == 0 {
+					ifd = s
+					break
+				}
+			}
+		}
+	}
+
+	w, wok := ifd[tagImageWidth].uint(0)
+	h, hok := ifd[tagImageLength].uint(0)
+	if wok && hok {
+		m.setDimensions(int(w), int(h))
+	}
+}
+
+func applyExifIFD(ifd map[uint16]tiffField, m *Metadata) {
+	m.DateTimeOriginal = firstString(m.DateTimeOriginal, ifd[tagDateTimeOrig].string())
+	m.CreateDate = firstString(m.CreateDate, ifd[tagCreateDate].string())
+	m.OffsetTime = firstString(m.OffsetTime, ifd[tagOffsetTime].string())
+	m.OffsetTimeOriginal = firstString(m.OffsetTimeOriginal, ifd[tagOffsetTimeOrig].string())
+	m.OffsetTimeDigitized = firstString(m.OffsetTimeDigitized, ifd[tagOffsetTimeDigit].string())
+	m.SubSecTimeOriginal = firstString(m.SubSecTimeOriginal, ifd[tagSubSecTimeOrig].string())
+	m.LensModel = firstString(m.LensModel, ifd[tagLensModel].string())
+
+	if v, ok := ifd[tagExposureTime].rational(0); ok {
+		m.ExposureTime = v
+	}
+	if v, ok := ifd[tagFNumber].rational(0); ok {
+		m.FNumber = v
+	}
+	if v, ok := ifd[tagFocalLength].rational(0); ok {
+		m.FocalLength = v
+	}
+	if v, ok := ifd[tagISO].uint(0); ok {
+		m.ISO = int(v)
+	}
+
+	w, wok := ifd[tagPixelXDimension].uint(0)
+	h, hok := ifd[tagPixelYDimension].uint(0)
+	if wok && hok {
+		m.setDimensions(int(w), int(h))
+	}
+
+	applyAppleMakerNote(ifd[tagMakerNote].value, m)
+}
+
+// applyAppleMakerNote reads the content identifier iPhones record in their
+// maker note. The note is a signature and version, a byte order mark and an
+// IFD with offsets relative to the start of the note.
+func applyAppleMakerNote(note []byte, m *Metadata) {
+	if len(note) < 16 || !bytes.HasPrefix(note, []byte("Apple iOS\x00")) {
+		return
+	}
+
+	var order binary.ByteOrder
+	switch string(note[12:14]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+
+	ifd, err := readIFD(note, order, 14)
+	if err != nil {
+		return
+	}
+	m.ContentIdentifier = firstString(m.ContentIdentifier, ifd[tagAppleContentIdentifier].string())
+}
+
+func applyGPSIFD(ifd map[uint16]tiffField, m *Metadata) {
+	lat, latOK := ifd[tagGPSLatitude].degrees()
+	lon, lonOK := ifd[tagGPSLongitude].degrees()
+	if !latOK || !lonOK {
+		return
+	}
+	if strings.HasPrefix(ifd[tagGPSLatitudeRef].string(), "S") {
+		lat = -lat
+	}
+	if strings.HasPrefix(ifd[tagGPSLongitudeRef].string(), "W") {
+		lon = -lon
+	}
+	// 0,0 is what some phones write when they had no fix
+	if lat == 0 && lon == 0 {
+		return
+	}
+
+	gps := &GPS{Latitude: lat, Longitude: lon}
+	if alt, ok := ifd[tagGPSAltitude].rational(0); ok {
+		if ref, ok := ifd[tagGPSAltitudeRef].uint(0); ok && ref == 1 {
+			alt = -alt
+		}
+		gps.Altitude = &alt
+	}
+	m.GPS = gps
+}
+
+// readIFD reads the entries of the IFD at offset, keyed by tag
+func readIFD(data []byte, order binary.ByteOrder, offset uint32) (map[uint16]tiffField, error) {
+	if uint64(offset)+2 > uint64(len(data)) {
+		return nil, fmt.Errorf("IFD offset %d out of range", offset)
+	}
+
+	count := int(order.Uint16(data[offset:]))
+	if count > maxIFDEntries {
+		return nil, fmt.Errorf("IFD has %d entries", count)
+	}
+
+	fields := make(map[uint16]tiffField, count)
+	for i := range count {
+		start := uint64(offset) + 2 + uint64(i)*12
+		if start+12 > uint64(len(data)) {
+			break
+		}
+		entry := data[start : start+12]
+
+		tag := order.Uint16(entry)
+		typ := order.Uint16(entry[2:])
+		n := order.Uint32(entry[4:])
+
+		size, ok := typeSizes[typ]
+		if !ok {
+			continue
+		}
+		total := uint64(size) * uint64(n)
+
+		var value []byte
+		if total <= 4 {
+			value = entry[8 : 8+total]
+		} else {
+			off := uint64(order.Uint32(entry[8:]))
+			if off+total > uint64(len(data)) {
+				continue
+			}
+			value = data[off : off+total]
+		}
+
+		fields[tag] = tiffField{typ: typ, count: n, value: value, order: order}
+	}
+
+	return fields, nil
+}
+
+// string returns an ASCII field without padding
+func (f tiffField) string() string {
+	if f.typ != 2 && f.typ != 7 {
+		return ""
+	}
+	s := string(f.value)
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// uint returns the i-th value of an integer field
+func (f tiffField) uint(i uint32) (uint64, bool) {
+	if i >= f.count {
+		return 0, false
+	}
+	switch f.typ {
+	case 1, 7:
+		return uint64(f.value[i]), true
+	case 3:
+		return uint64(f.order.Uint16(f.value[i*2:])), true
+	case 4:
+		return uint64(f.order.Uint32(f.value[i*4:])), true
+	case 9:
+		if v := int32(f.order.Uint32(f.value[i*4:])); v >= 0 {
+			return uint64(v), true
+		}
+	}
+	return 0, false
+}
+
+// rational returns the i-th value of a rational field
+func (f tiffField) rational(i uint32) (float64, bool) {
+	if i >= f.count {
+		return 0, false
+	}
+	switch f.typ {
+	case 5:
+		num := f.order.Uint32(f.value[i*8:])
+		den := f.order.Uint32(f.value[i*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		return float64(num) / float64(den), true
+	case 10:
+		num := int32(f.order.Uint32(f.value[i*8:]))
+		den := int32(f.order.Uint32(f.value[i*8+4:]))
+		if den == 0 {
+			return 0, false
+		}
+		return float64(num) / float64(den), true
+	}
+	if v, ok := f.uint(i); ok {
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// degrees converts a degrees/minutes/seconds GPS field to decimal degrees
+func (f tiffField) degrees() (float64, bool) {
+	d, ok := f.rational(0)
+	if !ok {
+		return 0, false
+	}
+	m, _ := f.rational(1)
+	s, _ := f.rational(2)
+	return d + m/60 + s/3600, true
+}
+
+func firstString(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
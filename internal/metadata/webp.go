@@ -0,0 +1,75 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// readWebP reads the RIFF chunks of a WebP file: VP8X, VP8 or VP8L for the
+// canvas size, and the EXIF and XMP chunks of the extended format
+func readWebP(r io.ReaderAt, size int64, m, xmp *Metadata) error {
+	off := int64(12)
+	for off+8 <= size {
+		header, err := readAt(r, off, 8)
+		if err != nil {
+			return err
+		}
+		fourCC := string(header[:4])
+		length := int64(binary.LittleEndian.Uint32(header[4:]))
+		dataOff := off + 8
+
+		switch fourCC {
+		case "VP8X":
+			data, err := readAt(r, dataOff, min(length, 10))
+			if err != nil {
+				return err
+			}
+			if len(data) == 10 {
+				// 24-bit little-endian canvas size minus one
+				width := int(data[4]) | int(data[5])<<8 | int(data[6])<<16
+				height := int(data[7]) | int(data[8])<<8 | int(data[9])<<16
+				m.setDimensions(width+1, height+1)
+			}
+
+		case "VP8 ":
+			data, err := readAt(r, dataOff, min(length, 10))
+			if err != nil {
+				return err
+			}
+			// Key frame start code, then 14-bit sizes with 2-bit scale
+			if len(data) == 10 && data[3] == 0x9d && data[4] == 0x01 && data[5] == 0x2a {
+				width := int(binary.LittleEndian.Uint16(data[6:]) & 0x3fff)
+				height := int(binary.LittleEndian.Uint16(data[8:]) & 0x3fff)
+				m.setDimensions(width, height)
+			}
+
+		case "VP8L":
+			data, err := readAt(r, dataOff, min(length, 5))
+			if err != nil {
+				return err
+			}
+			if len(data) == 5 && data[0] == 0x2f {
+				bits := binary.LittleEndian.Uint32(data[1:])
+				m.setDimensions(int(bits&0x3fff)+1, int(bits>>14&0x3fff)+1)
+			}
+
+		case "EXIF":
+			data, err := readAt(r, dataOff, length)
+			if err != nil {
+				return err
+			}
+			parseTIFF(trimExifHeader(data), m, false)
+
+		case "XMP ":
+			data, err := readAt(r, dataOff, length)
+			if err != nil {
+				return err
+			}
+			parseXMP(data, xmp)
+		}
+
+		// Chunks are padded to an even size
+		off = dataOff + length + length%2
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XMP namespaces of the properties read, by the prefix used in xmpProperties
+var xmpNamespaces = map[string]string{
+	"http://ns.adobe.com/exif/1.0/":      "exif",
+	"http://cipa.jp/exif/1.0/":           "exifEX",
+	"http://ns.adobe.com/tiff/1.0/":      "tiff",
+	"http://ns.adobe.com/xap/1.0/":       "xmp",
+	"http://ns.adobe.com/photoshop/1.0/": "photoshop",
+	"http://ns.adobe.com/exif/1.0/aux/":  "aux",
+}
+
+// parseXMP reads the properties tidyphotos uses from an XMP packet. Values
+// may be attributes of rdf:Description or child elements, including the
+// first item of an rdf:Seq, rdf:Bag or rdf:Alt.
+func parseXMP(packet []byte, m *Metadata) {
+	props := make(map[string]string)
+	set := func(name xml.Name, value string) {
+		prefix, ok := xmpNamespaces[name.Space]
+		value = strings.TrimSpace(value)
+		if !ok || value == "" {
+			return
+		}
+		key := prefix + ":" + name.Local
+		if _, seen := props[key]; !seen {
+			props[key] = value
+		}
+	}
+
+	// Strip the xpacket wrapper and trailing padding the decoder rejects
+	packet = bytes.TrimRight(packet, "\x00 \r\n\t")
+
+	dec := xml.NewDecoder(bytes.NewReader(packet))
+	dec.Strict = false
+
+	var stack []xml.Name
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			for _, attr := range t.Attr {
+				set(attr.Name, attr.Value)
+			}
+			stack = append(stack, t.Name)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			// The property is the nearest ancestor outside the RDF namespace
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].Space != "http://www.w3.org/1999/02/22-rdf-syntax-ns#" {
+					set(stack[i], string(t))
+					break
+				}
+			}
+		}
+	}
+
+	m.Make = props["tiff:Make"]
+	m.Model = props["tiff:Model"]
+	m.LensModel = firstString(props["exifEX:LensModel"], props["aux:Lens"])
+
+	if v, err := strconv.Atoi(props["tiff:Orientation"]); err == nil && v >= 1 && v <= 8 {
+		m.Orientation = v
+	}
+
+	if date, offset, subsec, ok := parseXMPDate(firstString(props["exif:DateTimeOriginal"], props["photoshop:DateCreated"])); ok {
+		m.DateTimeOriginal, m.OffsetTimeOriginal, m.SubSecTimeOriginal = date, offset, subsec
+	}
+	if date, offset, _, ok := parseXMPDate(firstString(props["xmp:CreateDate"], props["exif:DateTimeDigitized"])); ok {
+		m.CreateDate, m.OffsetTimeDigitized = date, offset
+	}
+
+	m.ExposureTime, _ = parseXMPRational(props["exif:ExposureTime"])
+	m.FNumber, _ = parseXMPRational(props["exif:FNumber"])
+	m.FocalLength, _ = parseXMPRational(props["exif:FocalLength"])
+	if v, err := strconv.Atoi(firstString(props["exifEX:PhotographicSensitivity"], props["exif:ISOSpeedRatings"])); err == nil {
+		m.ISO = v
+	}
+
+	w, werr := strconv.Atoi(firstString(props["exif:PixelXDimension"], props["tiff:ImageWidth"]))
+	h, herr := strconv.Atoi(firstString(props["exif:PixelYDimension"], props["tiff:ImageLength"]))
+	if werr == nil && herr == nil {
+		m.setDimensions(w, h)
+	}
+
+	lat, latOK := parseXMPCoordinate(props["exif:GPSLatitude"])
+	lon, lonOK := parseXMPCoordinate(props["exif:GPSLongitude"])
+	if latOK && lonOK && (lat != 0 || lon != 0) {
+		gps := &GPS{Latitude: lat, Longitude: lon}
+		if alt, ok := parseXMPRational(props["exif:GPSAltitude"]); ok {
+			if props["exif:GPSAltitudeRef"] == "1" {
+				alt = -alt
+			}
+			gps.Altitude = &alt
+		}
+		m.GPS = gps
+	}
+}
+
+// xmpDateLayouts are the ISO 8601 forms XMP dates take, most precise first
+var xmpDateLayouts = []string{
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+}
+
+// parseXMPDate converts an XMP date into EXIF's date layout, a separate UTC
+// offset when the date had one, and the subsecond digits
+func parseXMPDate(value string) (date, offset, subsec string, ok bool) {
+	if value == "" {
+		return "", "", "", false
+	}
+
+	for _, layout := range xmpDateLayouts {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+
+		date = t.Format("2006:01:02 15:04:05")
+		if strings.Contains(layout, "Z07:00") {
+			offset = t.Format("-07:00")
+		}
+		if i := strings.IndexByte(value, '.'); i >= 0 {
+			digits := value[i+1:]
+			if end := strings.IndexAny(digits, "Z+-"); end >= 0 {
+				digits = digits[:end]
+			}
+			subsec = digits
+		}
+		return date, offset, subsec, true
+	}
+	return "", "", "", false
+}
+
+// parseXMPRational parses "num/den" or a plain number
+func parseXMPRational(value string) (float64, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if num, den, found := strings.Cut(value, "/"); found {
+		n, err1 := strconv.ParseFloat(num, 64)
+		d, err2 := strconv.ParseFloat(den, 64)
+		if err1 != nil || err2 != nil || d == 0 {
+			return 0, false
+		}
+		return n / d, true
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	return v, err == nil
+}
+
+// parseXMPCoordinate parses XMP's "DDD,MM.mmmmK" or "DDD,MM,SSK" GPS form,
+// where K is N, S, E or W
+func parseXMPCoordinate(value string) (float64, bool) {
+	if len(value) < 2 {
+		return 0, false
+	}
+
+	ref := value[len(value)-1]
+	parts := strings.Split(value[:len(value)-1], ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+
+	var deg float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, false
+		}
+		deg += v / [3]float64{1, 60, 3600}[i]
+	}
+
+	switch ref {
+	case 'S', 'W':
+		return -deg, true
+	case 'N', 'E':
+		return deg, true
+	}
+	return 0, false
+}
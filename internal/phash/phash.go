@@ -0,0 +1,196 @@
+// Package phash computes perceptual hashes of images and finds hashes that
+// are within a Hamming distance of each other.
+package phash
+
+import (
+	"image"
+	"image/color"
+	"math/bits"
+)
+
+// DHash computes a 64-bit difference hash. The image is reduced to a 9x8
+// grayscale grid by area averaging, and each bit records whether a cell is
+// brighter than its right-hand neighbour. Small thumbnails hash as well as
+// originals, so callers should pass the smallest decoded version they have.
+func DHash(img image.Image) uint64 {
+	const w, h = 9, 8
+
+	var sum [h][w]float64
+	var count [h][w]int
+
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return 0
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		cy := (y - b.Min.Y) * h / b.Dy()
+		for x := b.Min.X; x < b.Max.X; x++ {
+			cx := (x - b.Min.X) * w / b.Dx()
+			gray := color.GrayModel.Convert(img.At(x, y)).(color.Gray)
+			sum[cy][cx] += float64(gray.Y)
+			count[cy][cx]++
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			left := sum[y][x] / float64(max(count[y][x], 1))
+			right := sum[y][x+1] / float64(max(count[y][x+1], 1))
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+// Distance returns the Hamming distance between two hashes
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Entry associates a hash with the photo it was computed from
+type Entry struct {
+	ID   int64
+	Hash uint64
+}
+
+// Match is an entry found within a distance of a query hash
+type Match struct {
+	Entry
+	Distance int
+}
+
+// Index is a BK-tree over Hamming distance, answering "which hashes are
+// within d of this one" without comparing against every entry
+type Index struct {
+	root *node
+	size int
+}
+
+type node struct {
+	entry    Entry
+	children map[int]*node
+}
+
+// NewIndex builds an index over the given entries
+func NewIndex(entries []Entry) *Index {
+	ix := &Index{}
+	for _, e := range entries {
+		ix.Add(e)
+	}
+	return ix
+}
+
+// Len returns the number of entries in the index
+func (ix *Index) Len() int {
+	return ix.size
+}
+
+// Add inserts an entry into the index
+func (ix *Index) Add(e Entry) {
+	ix.size++
+	if ix.root == nil {
+		ix.root = &node{entry: e}
+		return
+	}
+
+	n := ix.root
+	for {
+		d := Distance(n.entry.Hash, e.Hash)
+		child, ok := n.children[d]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[int]*node)
+			}
+			n.children[d] = &node{entry: e}
+			return
+		}
+		n = child
+	}
+}
+
+// Search returns every entry within maxDist of hash
+func (ix *Index) Search(hash uint64, maxDist int) []Match {
+	if ix.root == nil {
+		return nil
+	}
+
+	var matches []Match
+	stack := []*node{ix.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		d := Distance(n.entry.Hash, hash)
+		if d <= maxDist {
+			matches = append(matches, Match{Entry: n.entry, Distance: d})
+		}
+
+		// By the triangle inequality only children whose edge distance is
+		// within maxDist of d can hold matches
+		for edge, child := range n.children {
+			if edge >= d-maxDist && edge <= d+maxDist {
+				stack = append(stack, child)
+			}
+		}
+	}
+
+	return matches
+}
+
+// Cluster groups entries that are connected through chains of hashes within
+// maxDist of each other (single linkage). Only groups of two or more are
+// returned, each listing IDs in input order.
+func Cluster(entries []Entry, maxDist int) [][]int64 {
+	ix := NewIndex(entries)
+
+	// Union-find over entry positions
+	parent := make([]int, len(entries))
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+
+	position := make(map[int64]int, len(entries))
+	for i, e := range entries {
+		position[e.ID] = i
+	}
+
+	for i, e := range entries {
+		for _, m := range ix.Search(e.Hash, maxDist) {
+			j := position[m.ID]
+			if ri, rj := find(i), find(j); ri != rj {
+				parent[rj] = ri
+			}
+		}
+	}
+
+	groups := make(map[int][]int64)
+	var order []int
+	for i, e := range entries {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			order = append(order, root)
+		}
+		groups[root] = append(groups[root], e.ID)
+	}
+
+	var clusters [][]int64
+	for _, root := range order {
+		if len(groups[root]) > 1 {
+			clusters = append(clusters, groups[root])
+		}
+	}
+	return clusters
+}
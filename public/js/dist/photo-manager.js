@@ -1,36 +1,62 @@
+// Photos requested per page; the grid renders after the first one
+const PAGE_SIZE = 200;
 export class PhotoManager {
     constructor() {
         this.photos = [];
         this.loading = true;
+        this.loadingMore = false;
     }
     get isLoading() {
         return this.loading;
     }
+    // True while pages after the first are still being fetched
+    get isLoadingMore() {
+        return this.loadingMore;
+    }
     get allPhotos() {
         return this.photos;
     }
     async loadPhotos() {
         console.log("📡 TidyPhotos: Loading photos from API...");
         try {
-            const response = await fetch("/api/photos");
-            const data = await response.json();
-            if (!response.ok) {
-                throw new Error(`API error: ${response.status} ${response.statusText}`);
+            // Show the first page as soon as it arrives, then page through the
+            // rest of the library in the background
+            let page = await this.fetchPage(null);
+            this.photos = page.photos;
+            this.loading = false;
+            this.loadingMore = page.next_cursor !== null;
+            while (page.next_cursor !== null) {
+                page = await this.fetchPage(page.next_cursor);
+                this.photos = this.photos.concat(page.photos);
             }
-            this.photos = data;
+            this.loadingMore = false;
             // // Mock data for now
             // if (this.photos.length === 0) {
             //   console.log("⚠️ TidyPhotos: No photos from API, using mock data");
             //   this.photos = this.generateMockPhotos();
             // }
-            this.loading = false;
             console.log("✅ TidyPhotos: Photos loaded successfully");
         }
         catch (error) {
             console.error("❌ TidyPhotos: Failed to load photos:", error);
-            this.photos = this.generateMockPhotos();
+            // Keep the pages already shown
+            if (this.photos.length === 0) {
+                this.photos = this.generateMockPhotos();
+            }
             this.loading = false;
+            this.loadingMore = false;
+        }
+    }
+    async fetchPage(cursor) {
+        let url = `/api/photos?limit=${PAGE_SIZE}`;
+        if (cursor !== null) {
+            url += `&cursor=${encodeURIComponent(cursor)}`;
+        }
+        const response = await fetch(url);
+        if (!response.ok) {
+            throw new Error(`API error: ${response.status} ${response.statusText}`);
         }
+        return (await response.json());
     }
     generateMockPhotos() {
         const photos = [];
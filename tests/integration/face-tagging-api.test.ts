@@ -42,17 +42,17 @@ describe('Face Tagging API Integration', () => {
       const specialPhotoName = 'test photo with spaces & symbols.jpg'
       const response = await fetch(`${API_BASE}/api/photos/${encodeURIComponent(specialPhotoName)}/face-tags`)
 
-      // Should not return 404 due to encoding issues (even if photo doesn't exist)
+      // Should decode the name and find the photo, which exists in the test data
       expect(response.status).toBe(200)
+
+      const data = await response.json()
+      expect(Array.isArray(data.faceTags)).toBe(true)
     })
 
-    it('should return empty array for non-existent photo', async () => {
+    it('should return 404 for non-existent photo', async () => {
       const response = await fetch(`${API_BASE}/api/photos/nonexistent.jpg/face-tags`)
 
-      expect(response.status).toBe(200)
-
-      const data = await response.json()
-      expect(data.faceTags).toEqual([])
+      expect(response.status).toBe(404)
     })
   })
 
@@ -389,5 +389,59 @@ describe('Face Tagging API Integration', () => {
       expect(tagWithPerson.personId).toBe(testPerson.id)
       expect(tagWithPerson.personName).toBe(testPerson.name)
     })
+
+    it('should reject tags of a person that does not exist', async () => {
+      const tagData = {
+        x: 30,
+        y: 40,
+        width: 50,
+        height: 60,
+        personId: 99999,
+        confidence: 0.9,
+        isManual: true
+      }
+
+      const response = await fetch(`${API_BASE}/api/photos/${encodeURIComponent(testPhotoName)}/face-tags`, {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json'
+        },
+        body: JSON.stringify(tagData)
+      })
+
+      expect(response.status).toBe(400)
+      expect(await response.text()).toContain('Person not found')
+    })
+
+    it('should not reassign a tag to a person that does not exist', async () => {
+      const createResponse = await fetch(`${API_BASE}/api/photos/${encodeURIComponent(testPhotoName)}/face-tags`, {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ x: 30, y: 40, width: 50, height: 60, personId: null })
+      })
+      const createData = await createResponse.json()
+      const tagId = createData.faceTag.id
+      createdTagIds.push(tagId)
+
+      const response = await fetch(`${API_BASE}/api/face-tags/${tagId}`, {
+        method: 'PUT',
+        headers: {
+          'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ x: 30, y: 40, width: 50, height: 60, person_id: 99999, confidence: 1.0 })
+      })
+
+      expect(response.status).toBe(400)
+      expect(await response.text()).toContain('Person not found')
+
+      // The tag is left as it was
+      const getResponse = await fetch(`${API_BASE}/api/photos/${encodeURIComponent(testPhotoName)}/face-tags`)
+      const getData = await getResponse.json()
+
+      const tag = getData.faceTags.find((tag: any) => tag.id === tagId)
+      expect(tag.personId).toBeNull()
+    })
   })
 })
\ No newline at end of file